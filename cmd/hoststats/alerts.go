@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BilboTheGreedy/hostStats/collector"
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+// exitAlerts is the exit code when an alert rule fired
+const exitAlerts = 6
+
+// alertRule is an alert of the configuration with its Rule parsed
+type alertRule struct {
+	settings.Alert
+
+	metric    string
+	op        string
+	threshold float64
+}
+
+// alertStat is a host or cluster breaking a rule, Host is empty for cluster rules
+type alertStat struct {
+	Rule      string
+	VCenter   string
+	Cluster   string
+	Host      string
+	Metric    string
+	Value     float64
+	Threshold string
+}
+
+func (r alertStat) Headers() []string {
+	var res []string
+	t := reflect.TypeOf(r)
+	for i := 0; i < t.NumField(); i++ {
+		res = append(res, t.Field(i).Name)
+	}
+	return res
+}
+
+func (r alertStat) Slice() []string {
+	return []string{
+		r.Rule,
+		r.VCenter,
+		r.Cluster,
+		r.Host,
+		r.Metric,
+		strconv.FormatFloat(r.Value, 'f', -1, 64),
+		r.Threshold,
+	}
+}
+
+// alertNotice is the body posted to the AlertNotify webhooks
+type alertNotice struct {
+	Time   time.Time
+	Alerts []alertStat
+}
+
+var alertSyntax = regexp.MustCompile(`^\s*(.+?)\s*(<=|>=|==|!=|<|>)\s*(-?[0-9]+(?:\.[0-9]+)?)\s*$`)
+
+// derivedMetrics are the metrics computed from the columns, on top of the numeric columns themselves
+var derivedMetrics = []string{"FreeCPUPercent", "FreeMemoryPercent", "FreeMemoryGB", "Hosts"}
+
+// metricAliases are other names accepted in rules
+var metricAliases = map[string]string{"freecpumhz": "FreeCPU"}
+
+// metricName resolves a metric of a rule, spaces, underscores and case are ignored so "free memory percent" works
+func metricName(name string) (string, bool) {
+	key := strings.ToLower(strings.NewReplacer(" ", "", "_", "").Replace(name))
+	if alias, ok := metricAliases[key]; ok {
+		return alias, true
+	}
+	for _, metric := range derivedMetrics {
+		if strings.ToLower(metric) == key {
+			return metric, true
+		}
+	}
+	t := reflect.TypeOf(hostStat{})
+	for i := 0; i < t.NumField(); i++ {
+		kind := t.Field(i).Type.Kind()
+		if kind == reflect.Ptr {
+			kind = t.Field(i).Type.Elem().Kind()
+		}
+		switch kind {
+		case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float64:
+			if strings.ToLower(t.Field(i).Name) == key {
+				return t.Field(i).Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// prepareAlerts parses the rules
+func (config *Configuration) prepareAlerts() error {
+	config.alerts = make([]alertRule, len(config.Alerts))
+	for i, alert := range config.Alerts {
+		rule := &config.alerts[i]
+		rule.Alert = alert
+		m := alertSyntax.FindStringSubmatch(rule.Rule)
+		if m == nil {
+			return fmt.Errorf("%q: want a metric, an operator and a number, like \"FreeMemoryPercent < 10\"", rule.Rule)
+		}
+		metric, ok := metricName(m[1])
+		if !ok {
+			return fmt.Errorf("%q: unknown metric %q", rule.Rule, m[1])
+		}
+		if metric == "Hosts" && !rule.Cluster {
+			return fmt.Errorf("%q: Hosts is only known for cluster rules", rule.Rule)
+		}
+		rule.metric, rule.op = metric, m[2]
+		rule.threshold, _ = strconv.ParseFloat(m[3], 64)
+		if rule.Name == "" {
+			rule.Name = rule.Rule
+		}
+		for _, pattern := range append(rule.Clusters, rule.VCenters...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%q: invalid pattern %q", rule.Rule, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// applies reports whether the rule covers hosts of this cluster, vcenter and labels
+func (rule alertRule) applies(vcenter, cluster string, labels map[string]string) bool {
+	matches := func(patterns []string, value string) bool {
+		if len(patterns) == 0 {
+			return true
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, value); ok {
+				return true
+			}
+		}
+		return false
+	}
+	for key, value := range rule.Labels {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return matches(rule.Clusters, cluster) && matches(rule.VCenters, vcenter)
+}
+
+func (rule alertRule) breaks(value float64) bool {
+	switch rule.op {
+	case "<":
+		return value < rule.threshold
+	case "<=":
+		return value <= rule.threshold
+	case ">":
+		return value > rule.threshold
+	case ">=":
+		return value >= rule.threshold
+	case "==":
+		return value == rule.threshold
+	default:
+		return value != rule.threshold
+	}
+}
+
+// metricValue reads metric from s, hosts is the number of hosts s adds up
+func metricValue(s hostStat, metric string, hosts int) float64 {
+	memory := float64(s.MemorySize)
+	switch metric {
+	case "FreeCPUPercent":
+		if s.TotalCPU == 0 {
+			return 0
+		}
+		return float64(s.FreeCPU) / float64(s.TotalCPU) * 100
+	case "FreeMemoryPercent":
+		if memory == 0 {
+			return 0
+		}
+		return float64(s.FreeMemory) / memory * 100
+	case "FreeMemoryGB":
+		return float64(s.FreeMemory) / (1 << 30)
+	case "Hosts":
+		return float64(hosts)
+	}
+	f := reflect.ValueOf(s).FieldByName(metric)
+	if f.Kind() == reflect.Ptr {
+		// optional columns like EstimatedFreeVMs are nil when not collected
+		if f.IsNil() {
+			return 0
+		}
+		f = f.Elem()
+	}
+	if f.Kind() == reflect.Float64 {
+		return f.Float()
+	}
+	return float64(f.Int())
+}
+
+// clusterTotal adds up the numeric columns of the hosts of a cluster, the usage percentages and the
+// overcommit ratio are recomputed from the totals
+func clusterTotal(hosts []hostStat) hostStat {
+	total := reflect.New(reflect.TypeOf(hostStat{})).Elem()
+	var usedCPU float64
+	for _, host := range hosts {
+		usedCPU += host.CpuUsagePercent / 100 * float64(host.TotalCPU)
+		v := reflect.ValueOf(host)
+		for i := 0; i < v.NumField(); i++ {
+			switch f := total.Field(i); f.Kind() {
+			case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+				f.SetInt(f.Int() + v.Field(i).Int())
+			case reflect.Float64:
+				f.SetFloat(f.Float() + v.Field(i).Float())
+			case reflect.Ptr:
+				// an optional column adds up the hosts that have it
+				if host := v.Field(i); !host.IsNil() && host.Elem().CanInt() {
+					if f.IsNil() {
+						f.Set(reflect.New(f.Type().Elem()))
+					}
+					f.Elem().SetInt(f.Elem().Int() + host.Elem().Int())
+				}
+			}
+		}
+	}
+	s := total.Interface().(hostStat)
+	s.CpuUsagePercent = 0
+	if s.TotalCPU > 0 {
+		s.CpuUsagePercent = usedCPU / float64(s.TotalCPU) * 100
+	}
+	s.MemoryUsagePercent = collector.UsagePercent(s.OverallMemoryUsage, s.MemorySize)
+	s.VcpuOvercommitRatio = 0
+	if s.NumCpuCores > 0 {
+		s.VcpuOvercommitRatio = float64(s.ProvisionedVCPU) / float64(s.NumCpuCores)
+	}
+	return s
+}
+
+// evaluateAlerts checks every rule against the collected hosts and clusters
+func (config Configuration) evaluateAlerts() []alertStat {
+	alerts := []alertStat{}
+	type clusterHosts struct {
+		vcenter, cluster string
+		labels           map[string]string
+		hosts            []hostStat
+	}
+	clusters := make(map[string]*clusterHosts)
+	var keys []string
+	for _, vcenter := range config.VCenters {
+		for _, s := range vcenter.stats {
+			key := hostKey(s.VCenter, s.Cluster)
+			if clusters[key] == nil {
+				clusters[key] = &clusterHosts{vcenter: s.VCenter, cluster: s.Cluster, labels: s.Labels}
+				keys = append(keys, key)
+			}
+			clusters[key].hosts = append(clusters[key].hosts, s)
+		}
+	}
+	sort.Strings(keys)
+
+	threshold := func(rule alertRule) string {
+		return rule.op + " " + strconv.FormatFloat(rule.threshold, 'f', -1, 64)
+	}
+	for _, rule := range config.alerts {
+		for _, key := range keys {
+			c := clusters[key]
+			if !rule.applies(c.vcenter, c.cluster, c.labels) {
+				continue
+			}
+			if rule.Cluster {
+				value := metricValue(clusterTotal(c.hosts), rule.metric, len(c.hosts))
+				if rule.breaks(value) {
+					alerts = append(alerts, alertStat{Rule: rule.Name, VCenter: c.vcenter, Cluster: c.cluster, Metric: rule.metric, Value: value, Threshold: threshold(rule)})
+				}
+				continue
+			}
+			for _, s := range c.hosts {
+				if value := metricValue(s, rule.metric, 1); rule.breaks(value) {
+					alerts = append(alerts, alertStat{Rule: rule.Name, VCenter: s.VCenter, Cluster: s.Cluster, Host: s.Host, Metric: rule.metric, Value: value, Threshold: threshold(rule)})
+				}
+			}
+		}
+	}
+	return alerts
+}
+
+// checkAlerts evaluates the rules, writes AlertOutpath and sends AlertNotify when a rule fired
+func (config Configuration) checkAlerts(ctx context.Context) []alertStat {
+	if len(config.Alerts) == 0 {
+		return nil
+	}
+	alerts := config.evaluateAlerts()
+	for _, a := range alerts {
+		slog.Warn("alert", "phase", "alerts", "rule", a.Rule, "vcenter", a.VCenter, "cluster", a.Cluster, "host", a.Host, "value", a.Value)
+	}
+
+	if config.AlertOutpath != "" {
+		var rows [][]string
+		for _, a := range alerts {
+			rows = append(rows, a.Slice())
+		}
+		if err := config.exportTable(config.AlertOutpath, alertStat{}.Headers(), rows, alerts); err != nil {
+			slog.Error("could not write alerts", "phase", "write", "path", config.AlertOutpath, "error", err)
+		} else {
+			slog.Info("alerts saved", "phase", "write", "path", config.AlertOutpath)
+			config.written.add(config.AlertOutpath, len(rows))
+		}
+	}
+	if len(alerts) > 0 {
+		config.notify(ctx, config.AlertNotify, alertNotice{Time: time.Now(), Alerts: alerts}, alertsText(alerts))
+	}
+	return alerts
+}
+
+func alertsText(alerts []alertStat) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "hostStats: %d alerts", len(alerts))
+	for _, a := range alerts {
+		where := a.Host
+		if where == "" {
+			where = "cluster " + a.Cluster
+		}
+		fmt.Fprintf(&b, "\n• %s on %s: %s is %s, %s", where, a.VCenter, a.Metric, strconv.FormatFloat(a.Value, 'f', 2, 64), a.Rule)
+	}
+	return b.String()
+}
@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+// the usage percentages of a cluster are those of its total capacity, not the sum of its hosts
+func TestClusterTotalPercentages(t *testing.T) {
+	hosts := []hostStat{
+		{TotalCPU: 30000, CpuUsagePercent: 50, OverallMemoryUsage: 64, MemorySize: 256, MemoryUsagePercent: 25, NumCpuCores: 16, ProvisionedVCPU: 32},
+		{TotalCPU: 10000, CpuUsagePercent: 10, OverallMemoryUsage: 128, MemorySize: 256, MemoryUsagePercent: 50, NumCpuCores: 16, ProvisionedVCPU: 16},
+	}
+	total := clusterTotal(hosts)
+	if total.TotalCPU != 40000 || total.MemorySize != 512 {
+		t.Errorf("cluster capacity %d MHz and %d bytes, want 40000 and 512", total.TotalCPU, total.MemorySize)
+	}
+	if total.CpuUsagePercent != 40 || total.MemoryUsagePercent != 37.5 || total.VcpuOvercommitRatio != 1.5 {
+		t.Errorf("cluster uses %v%% CPU and %v%% memory with a ratio of %v, want 40, 37.5 and 1.5", total.CpuUsagePercent, total.MemoryUsagePercent, total.VcpuOvercommitRatio)
+	}
+}
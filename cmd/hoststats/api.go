@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vcenterStatus is the outcome of the latest collections from one vcenter
+type vcenterStatus struct {
+	Name          string
+	Hostname      string
+	HostCount     int
+	LastSuccess   *time.Time `json:",omitempty"`
+	LastError     string     `json:",omitempty"`
+	LastErrorTime *time.Time `json:",omitempty"`
+	FailingSince  *time.Time `json:",omitempty"`
+}
+
+// apiSnapshot is the result of one finished cycle, it is replaced as a whole and never modified
+type apiSnapshot struct {
+	output   *output
+	hosts    []hostStat
+	vcenters []vcenterStatus
+}
+
+// apiServer serves the latest results in daemon mode:
+// GET /api/hosts, filterable by ?vcenter= and ?cluster=,
+// GET /api/vcenters, POST /api/run and POST /api/run/trigger to start a collection now
+// and GET /api/runs for the last runs.
+// /metrics has the collector's own prometheus metrics.
+// /healthz and /readyz are for probes and need no token.
+type apiServer struct {
+	token    string
+	server   *http.Server
+	trigger  chan struct{}
+	reloader *configReloader
+	runs     *runHistory
+
+	mu          sync.RWMutex
+	snapshot    *apiSnapshot
+	status      map[string]vcenterStatus
+	lastSuccess time.Time
+	metrics     collectorMetrics
+}
+
+// newAPIServer returns nil when no Listen address is configured
+func newAPIServer(reloader *configReloader) *apiServer {
+	config := reloader.current()
+	if config.Listen == "" {
+		return nil
+	}
+	registerSecret(config.APIToken)
+	api := &apiServer{
+		token:    config.APIToken,
+		trigger:  make(chan struct{}, 1),
+		reloader: reloader,
+		runs:     newRunHistory(config),
+		snapshot: &apiSnapshot{output: config.outputs[0]},
+		status:   make(map[string]vcenterStatus),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/hosts", api.authorized(api.hosts))
+	mux.HandleFunc("/api/vcenters", api.authorized(api.vcenters))
+	mux.HandleFunc("/api/run", api.authorized(api.runNow))
+	mux.HandleFunc("/api/run/trigger", api.authorized(api.run))
+	mux.HandleFunc("/api/runs", api.authorized(api.listRuns))
+	mux.HandleFunc("/metrics", api.authorized(api.serveMetrics))
+	mux.HandleFunc("/healthz", api.healthz)
+	mux.HandleFunc("/readyz", api.readyz)
+	api.server = &http.Server{Addr: config.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return api
+}
+
+func (api *apiServer) start() {
+	if api == nil {
+		return
+	}
+	go func() {
+		slog.Info("serving results", "address", api.server.Addr)
+		if err := api.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("could not serve results", "address", api.server.Addr, "error", err)
+		}
+	}()
+}
+
+func (api *apiServer) stop() {
+	if api == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	api.server.Shutdown(ctx)
+}
+
+// triggered is signalled by POST /api/run/trigger, it never fires without a server
+func (api *apiServer) triggered() <-chan struct{} {
+	if api == nil {
+		return nil
+	}
+	return api.trigger
+}
+
+// started records a cycle starting, a triggered run still queued is satisfied by it
+func (api *apiServer) started(start time.Time) {
+	if api == nil {
+		return
+	}
+	select {
+	case <-api.trigger:
+	default:
+	}
+	api.runs.started(start)
+}
+
+// update publishes the results of a finished cycle
+func (api *apiServer) update(config Configuration, summary runSummary, finished time.Time) {
+	if api == nil {
+		return
+	}
+	api.runs.finished(summary, finished)
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.metrics.update(summary)
+	if summary.collected() {
+		api.lastSuccess = finished
+	}
+
+	snapshot := &apiSnapshot{output: config.outputs[0], hosts: []hostStat{}}
+	for _, vcenter := range config.VCenters {
+		snapshot.hosts = append(snapshot.hosts, vcenter.stats...)
+
+		status := api.status[vcenter.Hostname]
+		status.Name = vcenter.DisplayName()
+		status.Hostname = vcenter.Hostname
+		if vcenter.err != nil {
+			status.LastError = vcenter.err.Error()
+			status.LastErrorTime = &finished
+			if status.FailingSince == nil {
+				status.FailingSince = &finished
+			}
+		} else {
+			status.HostCount = len(vcenter.stats) + vcenter.hostCount
+			status.LastSuccess = &finished
+			status.FailingSince = nil
+		}
+		api.status[vcenter.Hostname] = status
+		snapshot.vcenters = append(snapshot.vcenters, status)
+	}
+	api.snapshot = snapshot
+}
+
+func (api *apiServer) current() *apiSnapshot {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+	return api.snapshot
+}
+
+// authorized checks the bearer token when APIToken is set
+func (api *apiServer) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if api.token != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+func (api *apiServer) hosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	snapshot := api.current()
+	vcenter := r.URL.Query().Get("vcenter")
+	cluster := r.URL.Query().Get("cluster")
+
+	hosts := []hostStat{}
+	for _, host := range snapshot.hosts {
+		if vcenter != "" && !strings.EqualFold(host.VCenter, vcenter) {
+			continue
+		}
+		if cluster != "" && !strings.EqualFold(host.Cluster, cluster) {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	writeJSON(w, snapshot.output.records(hosts))
+}
+
+func (api *apiServer) vcenters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	vcenters := api.current().vcenters
+	if vcenters == nil {
+		vcenters = []vcenterStatus{}
+	}
+	writeJSON(w, vcenters)
+}
+
+// run queues a collection, a cycle already running is not interrupted and the new one starts after it
+func (api *apiServer) run(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	api.runs.queue()
+	api.queue()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// runAnswer is the body of POST /api/run
+type runAnswer struct {
+	ID     int
+	Status string
+}
+
+// runNow starts a collection unless one is running, it answers 409 with the id of the running one
+// and 202 with the id the new run gets otherwise
+func (api *apiServer) runNow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := api.runs.request()
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(runAnswer{ID: id, Status: "running"})
+		return
+	}
+	api.queue()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(runAnswer{ID: id, Status: "started"})
+}
+
+// queue wakes the daemon for a run, a run already queued is enough
+func (api *apiServer) queue() {
+	select {
+	case api.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (api *apiServer) listRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, api.runs.list())
+}
+
+func (api *apiServer) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	api.metrics.write(w)
+}
+
+// healthz answers as long as the process is running
+func (api *apiServer) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"Status": "ok"})
+}
+
+// readiness is the body of /readyz
+type readiness struct {
+	Ready       bool
+	Reasons     []string        `json:",omitempty"`
+	LastSuccess *time.Time      `json:",omitempty"`
+	Failing     []vcenterStatus `json:",omitempty"`
+}
+
+// readyz is ready when a cycle succeeded within ReadyIntervals periods and the
+// configuration loaded, otherwise it answers 503. Failing vcenters are listed either way.
+func (api *apiServer) readyz(w http.ResponseWriter, r *http.Request) {
+	config := api.reloader.current()
+	intervals := config.ReadyIntervals
+	if intervals <= 0 {
+		intervals = 3
+	}
+	window := time.Duration(intervals) * config.period()
+
+	api.mu.RLock()
+	lastSuccess := api.lastSuccess
+	vcenters := api.snapshot.vcenters
+	api.mu.RUnlock()
+
+	ready := readiness{Ready: true}
+	switch {
+	case lastSuccess.IsZero():
+		ready.Ready = false
+		ready.Reasons = append(ready.Reasons, "no successful collection yet")
+	case time.Since(lastSuccess) > window:
+		ready.Ready = false
+		ready.Reasons = append(ready.Reasons, fmt.Sprintf("no successful collection in the last %s", window))
+	}
+	if !lastSuccess.IsZero() {
+		ready.LastSuccess = &lastSuccess
+	}
+	if err := api.reloader.lastError(); err != nil {
+		ready.Ready = false
+		ready.Reasons = append(ready.Reasons, "configuration error: "+err.Error())
+	}
+	for _, status := range vcenters {
+		if status.FailingSince != nil {
+			ready.Failing = append(ready.Failing, status)
+		}
+	}
+
+	if !ready.Ready {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ready)
+		return
+	}
+	writeJSON(w, ready)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("could not write api response", "error", err)
+	}
+}
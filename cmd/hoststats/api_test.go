@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+// a cycle that collected is a success for /readyz whatever its exit code says about the results
+func TestReadyAfterCollectedCycle(t *testing.T) {
+	ok := []vcenterSummary{{Status: "ok"}, {Status: "failed"}}
+	failed := []vcenterSummary{{Status: "failed"}}
+	tests := []struct {
+		name    string
+		summary runSummary
+		ready   bool
+	}{
+		{"clean", runSummary{ExitCode: 0, VCenters: ok}, true},
+		{"alert", runSummary{ExitCode: exitAlerts, VCenters: ok}, true},
+		{"partial", runSummary{ExitCode: exitPartial, VCenters: ok}, true},
+		{"too few hosts", runSummary{ExitCode: exitTooFewHosts, VCenters: ok}, true},
+		{"every vcenter failed", runSummary{ExitCode: 1, VCenters: failed}, false},
+		{"timed out before any vcenter", runSummary{ExitCode: exitPartial, VCenters: failed}, false},
+		{"shutdown", runSummary{ExitCode: exitShutdown, VCenters: ok}, false},
+	}
+	for _, tt := range tests {
+		config := preparedConfig(t)
+		config.Listen = "127.0.0.1:0"
+		config.Interval = settings.Duration(15 * time.Minute)
+		api := newAPIServer(newConfigReloader("", options{}, config))
+		api.update(config, tt.summary, time.Now())
+
+		w := httptest.NewRecorder()
+		api.readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+		if ready := w.Code == http.StatusOK; ready != tt.ready {
+			t.Errorf("%s: /readyz answered %d, want ready %v", tt.name, w.Code, tt.ready)
+		}
+	}
+}
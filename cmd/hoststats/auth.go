@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/sts"
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// login authenticates with the vcenter using its Auth method:
+// "password" (default) logs in with the bearer token in Token or TokenEnv when there is one, with Username/Password otherwise,
+// "sso-token" logs in with the SAML token in TokenFile, or with a token issued by the STS for the Certificate/PrivateKey pair,
+// "sspi" uses the current Windows user's credentials.
+func (vcenter *VCenter) login(ctx context.Context, client *govmomi.Client, u *url.URL) error {
+	switch vcenter.Auth {
+	case "", "password":
+		if token := vcenter.token(); token != "" {
+			return loginByBearer(ctx, client, &sts.Signer{Token: token})
+		}
+		return client.Login(ctx, u.User)
+	case "sso-token":
+		return vcenter.loginByToken(ctx, client, u)
+	case "sspi":
+		return loginBySSPI(ctx, client, u.Hostname())
+	default:
+		return fmt.Errorf("unknown auth method %q", vcenter.Auth)
+	}
+}
+
+func (vcenter *VCenter) loginByToken(ctx context.Context, client *govmomi.Client, u *url.URL) error {
+	signer := &sts.Signer{}
+
+	if vcenter.Certificate != "" || vcenter.PrivateKey != "" {
+		cert, err := tls.LoadX509KeyPair(vcenter.Certificate, vcenter.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("could not load certificate: %v", err)
+		}
+		signer.Certificate = &cert
+	}
+
+	switch {
+	case vcenter.token() != "":
+		signer.Token = vcenter.token()
+	case vcenter.TokenFile != "":
+		token, err := os.ReadFile(vcenter.TokenFile)
+		if err != nil {
+			return fmt.Errorf("could not read token: %v", err)
+		}
+		signer.Token = string(token)
+	case signer.Certificate != nil:
+		stsClient, err := sts.NewClient(ctx, client.Client)
+		if err != nil {
+			return fmt.Errorf("could not connect to sts: %v", err)
+		}
+		signer, err = stsClient.Issue(ctx, sts.TokenRequest{Certificate: signer.Certificate, Delegatable: true})
+		if err != nil {
+			return fmt.Errorf("could not issue token: %v", err)
+		}
+	default:
+		return fmt.Errorf("sso-token auth needs a Token, TokenEnv, TokenFile or a Certificate and PrivateKey")
+	}
+	return loginByBearer(ctx, client, signer)
+}
+
+// loginByBearer logs in with SessionManager.LoginByToken, the token goes in the WS-Security header of the
+// request. A signer without a Certificate sends it as a bearer token, with one as a holder-of-key token.
+func loginByBearer(ctx context.Context, client *govmomi.Client, signer *sts.Signer) error {
+	header := soap.Header{Security: signer}
+	return client.SessionManager.LoginByToken(client.WithHeader(ctx, header))
+}
+
+// token returns the vcenter's Token, or the value of the environment variable named in TokenEnv.
+// The variable is read on every connect so a refreshed short-lived token is picked up.
+func (vcenter *VCenter) token() string {
+	token := vcenter.Token
+	if vcenter.TokenEnv != "" {
+		token = os.Getenv(vcenter.TokenEnv)
+	}
+	token = strings.TrimSpace(token)
+	registerSecret(token)
+	return token
+}
+
+// password returns the vcenter's Password, or the contents of its PasswordFile when set.
+// The file is read on every connect so an updated secret mount is picked up.
+func (vcenter *VCenter) password() (string, error) {
+	if vcenter.PasswordFile == "" {
+		registerSecret(vcenter.Password)
+		return vcenter.Password, nil
+	}
+	b, err := os.ReadFile(vcenter.PasswordFile)
+	if err != nil {
+		return "", err
+	}
+	password := strings.TrimRight(string(b), "\r\n")
+	registerSecret(password)
+	return password, nil
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vmware/govmomi"
+)
+
+func loginBySSPI(ctx context.Context, client *govmomi.Client, host string) error {
+	return fmt.Errorf("sspi auth is only supported on windows")
+}
@@ -0,0 +1,68 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/alexbrainman/sspi/negotiate"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// loginBySSPI logs in as the current windows user, answering SSPIChallenge faults until the handshake completes
+func loginBySSPI(ctx context.Context, client *govmomi.Client, host string) error {
+	cred, err := negotiate.AcquireCurrentUserCredentials()
+	if err != nil {
+		return err
+	}
+	defer cred.Release()
+
+	secctx, token, err := negotiate.NewClientContext(cred, "host/"+host)
+	if err != nil {
+		return err
+	}
+	defer secctx.Release()
+
+	for {
+		req := types.LoginBySSPI{
+			This:        *client.ServiceContent.SessionManager,
+			Base64Token: base64.StdEncoding.EncodeToString(token),
+			Locale:      session.Locale,
+		}
+		_, err := methods.LoginBySSPI(ctx, client.Client, &req)
+		if err == nil {
+			return nil
+		}
+
+		challenge, ok := sspiChallenge(err)
+		if !ok {
+			return err
+		}
+		in, err := base64.StdEncoding.DecodeString(challenge)
+		if err != nil {
+			return err
+		}
+		if _, token, err = secctx.Update(in); err != nil {
+			return err
+		}
+	}
+}
+
+func sspiChallenge(err error) (string, bool) {
+	if !soap.IsSoapFault(err) {
+		return "", false
+	}
+	switch fault := soap.ToSoapFault(err).VimFault().(type) {
+	case types.SSPIChallenge:
+		return fault.Base64Token, true
+	case *types.SSPIChallenge:
+		return fault.Base64Token, true
+	}
+	return "", false
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// bootDevice tells how a host booted: "stateless" for auto deploy hosts running from memory,
+// "stateless-cache" for auto deploy hosts booted from their cached image, and for hosts installed
+// on local storage "sd", "usb" or "disk" by the device they booted from. That device is the disk
+// of the OSDATA volume when it has one, else the current device of the host's HostBootDeviceSystem,
+// boot is what that returned, nil when it wasn't queried. Only the boot device is classified, an SD
+// card or USB stick the host merely has doesn't count. It is "unknown" when the host config is
+// missing or the boot device can't be resolved.
+func bootDevice(hs mo.HostSystem, boot *types.HostBootDeviceInfo) string {
+	if hs.Config == nil || hs.Config.FileSystemVolume == nil {
+		return "unknown"
+	}
+	if d := hs.Config.DeploymentInfo; d != nil && d.BootedFromStatelessCache != nil && *d.BootedFromStatelessCache {
+		return "stateless-cache"
+	}
+	if !hasBootbank(hs.Config.FileSystemVolume) {
+		return "stateless"
+	}
+	if lun := bootLun(hs); lun != nil {
+		if kind := flashKind(lun.Vendor + " " + lun.Model + " " + lun.DisplayName); kind != "" {
+			return kind
+		}
+		return "disk"
+	}
+	if description := currentBootDevice(boot); description != "" {
+		if kind := flashKind(description); kind != "" {
+			return kind
+		}
+		return "disk"
+	}
+	return "unknown"
+}
+
+// bootLun is the local device the OSDATA volume lives on, nil when the host doesn't tell.
+// Hosts installed before ESXi 7 or on SD and USB devices have only vfat boot banks, which carry no device.
+func bootLun(hs mo.HostSystem) *types.ScsiLun {
+	if hs.Config.StorageDevice == nil {
+		return nil
+	}
+	for _, mount := range hs.Config.FileSystemVolume.MountInfo {
+		vmfs, ok := mount.Volume.(*types.HostVmfsVolume)
+		if !ok || (vmfs.Type != "VMFSOS" && vmfs.Type != "OSDATA") || len(vmfs.Extent) == 0 {
+			continue
+		}
+		for _, lun := range hs.Config.StorageDevice.ScsiLun {
+			if l := lun.GetScsiLun(); l.CanonicalName == vmfs.Extent[0].DiskName {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// currentBootDevice is the description of the device the host booted from, empty when unknown
+func currentBootDevice(boot *types.HostBootDeviceInfo) string {
+	if boot == nil || boot.CurrentBootDeviceKey == "" {
+		return ""
+	}
+	for _, device := range boot.BootDevices {
+		if device.Key == boot.CurrentBootDeviceKey {
+			return device.Description
+		}
+	}
+	return ""
+}
+
+// needsBootDevices reports whether the boot device of the host has to be queried, that is when
+// it was installed on local storage and the OSDATA volume doesn't name its device
+func needsBootDevices(hs mo.HostSystem) bool {
+	if hs.Config == nil || hs.Config.FileSystemVolume == nil || hs.ConfigManager.BootDeviceSystem == nil {
+		return false
+	}
+	if rt := hs.Summary.Runtime; rt != nil && rt.ConnectionState != types.HostSystemConnectionStateConnected {
+		return false
+	}
+	if d := hs.Config.DeploymentInfo; d != nil && d.BootedFromStatelessCache != nil && *d.BootedFromStatelessCache {
+		return false
+	}
+	return hasBootbank(hs.Config.FileSystemVolume) && bootLun(hs) == nil
+}
+
+// bootDevices queries the HostBootDeviceSystem of the hosts that need it, by host MoRef. vCenter
+// has no bulk call for it, every host is a call of its own bounded by RetrieveTimeoutSeconds.
+// A host whose query fails is left out and its BootDevice is unknown, the first error is returned
+// with what was found.
+func (config Configuration) bootDevices(ctx context.Context, c *vim25.Client, hss []mo.HostSystem) (map[string]*types.HostBootDeviceInfo, error) {
+	devices := make(map[string]*types.HostBootDeviceInfo)
+	var first error
+	for _, hs := range hss {
+		if !needsBootDevices(hs) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return devices, ctx.Err()
+		}
+		querying, cancel := config.retrieveContext(ctx)
+		res, err := methods.QueryBootDevices(querying, c, &types.QueryBootDevices{This: *hs.ConfigManager.BootDeviceSystem})
+		cancel()
+		if err != nil {
+			if first == nil {
+				first = fmt.Errorf("%s: %w", hs.Summary.Config.Name, err)
+			}
+			continue
+		}
+		devices[hs.Reference().Value] = res.Returnval
+	}
+	return devices, first
+}
+
+// hasBootbank reports whether a boot bank or OSDATA volume is mounted from persistent storage,
+// stateless hosts keep theirs in memory
+func hasBootbank(volumes *types.HostFileSystemVolumeInfo) bool {
+	for _, mount := range volumes.MountInfo {
+		if _, ok := mount.Volume.(*types.HostVfatVolume); ok {
+			return true
+		}
+		if mount.Volume != nil {
+			switch mount.Volume.GetHostFileSystemVolume().Type {
+			case "VMFSOS", "OSDATA":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// flashKind is "sd" or "usb" when the name of a device says it is a SD card or USB flash device, empty for anything else
+func flashKind(name string) string {
+	name = strings.ToUpper(name)
+	switch {
+	case strings.Contains(name, "SD-CARD"), strings.Contains(name, "SD CARD"), strings.Contains(name, "SD/MMC"),
+		strings.Contains(name, "IDSDM"), strings.Contains(name, "DUAL SD"):
+		return "sd"
+	case strings.Contains(name, "USB"):
+		return "usb"
+	}
+	return ""
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/BilboTheGreedy/hostStats/collector"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/units"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// clusterStat rolls up the hosts of one cluster. CPU is in MHz, memory in bytes.
+// Hosts, Total, Used and Free are summed over the same connected hosts of the cluster, so Free
+// is what those hosts have left. The effective figures are what the cluster reports as available
+// from its healthy hosts, the HA reserve is taken from those and EffectiveFree is what is left to schedule.
+type clusterStat struct {
+	VCenter               string
+	Cluster               string
+	Hosts                 int32
+	EffectiveHosts        int32
+	HAEnabled             bool
+	AdmissionControl      string
+	TotalCPU              int64
+	EffectiveCPU          int64
+	HAReservedCPU         int64
+	UsedCPU               int64
+	FreeCPU               int64
+	EffectiveFreeCPU      int64
+	TotalMemory           int64
+	EffectiveMemory       int64
+	HAReservedMemory      int64
+	UsedMemory            int64
+	FreeMemory            int64
+	EffectiveFreeMemory   int64
+	CurrentFailoverLevel  int32
+	CpuFailoverPercent    int32
+	MemoryFailoverPercent int32
+}
+
+func (r clusterStat) Headers() []string {
+	var res []string
+	t := reflect.TypeOf(r)
+	for i := 0; i < t.NumField(); i++ {
+		res = append(res, t.Field(i).Name)
+	}
+	return res
+}
+
+func (r clusterStat) Slice() []string {
+	return []string{
+		r.VCenter,
+		r.Cluster,
+		strconv.FormatInt(int64(r.Hosts), 10),
+		strconv.FormatInt(int64(r.EffectiveHosts), 10),
+		strconv.FormatBool(r.HAEnabled),
+		r.AdmissionControl,
+		strconv.FormatInt(r.TotalCPU, 10),
+		strconv.FormatInt(r.EffectiveCPU, 10),
+		strconv.FormatInt(r.HAReservedCPU, 10),
+		strconv.FormatInt(r.UsedCPU, 10),
+		strconv.FormatInt(r.FreeCPU, 10),
+		strconv.FormatInt(r.EffectiveFreeCPU, 10),
+		fmt.Sprintf("%s", units.ByteSize(r.TotalMemory)),
+		fmt.Sprintf("%s", units.ByteSize(r.EffectiveMemory)),
+		fmt.Sprintf("%s", units.ByteSize(r.HAReservedMemory)),
+		fmt.Sprintf("%s", units.ByteSize(r.UsedMemory)),
+		fmt.Sprintf("%s", units.ByteSize(r.FreeMemory)),
+		fmt.Sprintf("%s", units.ByteSize(r.EffectiveFreeMemory)),
+		strconv.FormatInt(int64(r.CurrentFailoverLevel), 10),
+		strconv.FormatInt(int64(r.CpuFailoverPercent), 10),
+		strconv.FormatInt(int64(r.MemoryFailoverPercent), 10),
+	}
+}
+
+// hostCapacity is what one host adds to its cluster, nothing unless it is connected
+type hostCapacity struct {
+	connected           bool
+	cpu, memory         int64
+	usedCPU, usedMemory int64
+}
+
+func capacityOf(hs mo.HostSystem) hostCapacity {
+	hw := hs.Summary.Hardware
+	if hw == nil {
+		return hostCapacity{}
+	}
+	if rt := hs.Summary.Runtime; rt != nil && rt.ConnectionState != types.HostSystemConnectionStateConnected {
+		return hostCapacity{}
+	}
+	return hostCapacity{
+		connected:  true,
+		cpu:        collector.CPUCapacityMHz(hw),
+		memory:     hw.MemorySize,
+		usedCPU:    collector.CPUUsedMHz(hs.Summary.QuickStats),
+		usedMemory: collector.MemUsedBytes(hs.Summary.QuickStats),
+	}
+}
+
+// clusterStats rolls up the collected hosts per cluster, hosts outside a cluster are left out.
+// All clusters are looked up in one call.
+func clusterStats(ctx context.Context, pc *property.Collector, vcenter string, hss []mo.HostSystem) ([]clusterStat, error) {
+	hosts := make(map[types.ManagedObjectReference][]hostCapacity)
+	capacity := make(map[types.ManagedObjectReference]hostCapacity)
+	var refs []types.ManagedObjectReference
+	for _, hs := range hss {
+		if hs.Parent == nil || hs.Parent.Type != "ClusterComputeResource" {
+			continue
+		}
+		if _, ok := hosts[*hs.Parent]; !ok {
+			refs = append(refs, *hs.Parent)
+		}
+		c := capacityOf(hs)
+		hosts[*hs.Parent] = append(hosts[*hs.Parent], c)
+		capacity[hs.Reference()] = c
+	}
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	var clusters []mo.ClusterComputeResource
+	if err := pc.Retrieve(ctx, refs, []string{"name", "summary", "configurationEx"}, &clusters); err != nil {
+		return nil, err
+	}
+
+	var stats []clusterStat
+	for _, cluster := range clusters {
+		stat := clusterStat{VCenter: vcenter, Cluster: cluster.Name}
+		for _, c := range hosts[cluster.Reference()] {
+			if !c.connected {
+				continue
+			}
+			stat.Hosts++
+			stat.TotalCPU += c.cpu
+			stat.TotalMemory += c.memory
+			stat.UsedCPU += c.usedCPU
+			stat.UsedMemory += c.usedMemory
+		}
+		if cluster.Summary != nil {
+			summary := cluster.Summary.GetComputeResourceSummary()
+			stat.EffectiveHosts = summary.NumEffectiveHosts
+			stat.EffectiveCPU = int64(summary.EffectiveCpu)
+			stat.EffectiveMemory = collector.MBToBytes(summary.EffectiveMemory)
+		}
+		if summary, ok := cluster.Summary.(*types.ClusterComputeResourceSummary); ok {
+			stat.CurrentFailoverLevel = summary.CurrentFailoverLevel
+		}
+		if config, ok := cluster.ConfigurationEx.(*types.ClusterConfigInfoEx); ok {
+			stat.haReserve(config.DasConfig, hosts[cluster.Reference()], capacity)
+		}
+		stat.FreeCPU = stat.TotalCPU - stat.UsedCPU
+		stat.FreeMemory = stat.TotalMemory - stat.UsedMemory
+		stat.EffectiveFreeCPU = stat.EffectiveCPU - stat.HAReservedCPU - stat.UsedCPU
+		stat.EffectiveFreeMemory = stat.EffectiveMemory - stat.HAReservedMemory - stat.UsedMemory
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
+
+// haReserve sets the capacity HA admission control holds back for failover.
+// With a percentage policy that is the percentage of the effective capacity, with dedicated
+// failover hosts their capacity. For a host failures (slot) policy the exact slot size isn't
+// exposed, the capacity of the largest hosts that may fail is used instead.
+func (stat *clusterStat) haReserve(das types.ClusterDasConfigInfo, hosts []hostCapacity, capacity map[types.ManagedObjectReference]hostCapacity) {
+	stat.HAEnabled = das.Enabled != nil && *das.Enabled
+	stat.AdmissionControl = "disabled"
+	if !stat.HAEnabled || (das.AdmissionControlEnabled != nil && !*das.AdmissionControlEnabled) || das.AdmissionControlPolicy == nil {
+		return
+	}
+
+	switch policy := das.AdmissionControlPolicy.(type) {
+	case *types.ClusterFailoverResourcesAdmissionControlPolicy:
+		stat.AdmissionControl = "percentage"
+		stat.CpuFailoverPercent = policy.CpuFailoverResourcesPercent
+		stat.MemoryFailoverPercent = policy.MemoryFailoverResourcesPercent
+		stat.HAReservedCPU = stat.EffectiveCPU * int64(policy.CpuFailoverResourcesPercent) / 100
+		stat.HAReservedMemory = stat.EffectiveMemory * int64(policy.MemoryFailoverResourcesPercent) / 100
+	case *types.ClusterFailoverHostAdmissionControlPolicy:
+		stat.AdmissionControl = "failoverHosts"
+		for _, ref := range policy.FailoverHosts {
+			stat.HAReservedCPU += capacity[ref].cpu
+			stat.HAReservedMemory += capacity[ref].memory
+		}
+	case *types.ClusterFailoverLevelAdmissionControlPolicy:
+		stat.AdmissionControl = "hostFailures"
+		cpu := make([]int64, len(hosts))
+		memory := make([]int64, len(hosts))
+		for i, c := range hosts {
+			cpu[i] = c.cpu
+			memory[i] = c.memory
+		}
+		stat.HAReservedCPU = largest(cpu, int(policy.FailoverLevel))
+		stat.HAReservedMemory = largest(memory, int(policy.FailoverLevel))
+	default:
+		stat.AdmissionControl = "other"
+	}
+}
+
+// largest sums the n largest values
+func largest(values []int64, n int) int64 {
+	sort.Slice(values, func(i, j int) bool { return values[i] > values[j] })
+	var sum int64
+	for i := 0; i < n && i < len(values); i++ {
+		sum += values[i]
+	}
+	return sum
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// the vcsim vcenter model has a standalone host and a cluster of three, one of them is disconnected here
+func TestStandaloneAndDisconnectedHosts(t *testing.T) {
+	vcenter := newSimulator(t, nil)
+	cluster := simulator.Map.Any("ClusterComputeResource").(*simulator.ClusterComputeResource)
+	disconnected := simulator.Map.Get(cluster.Host[0]).(*simulator.HostSystem)
+	disconnected.Runtime.ConnectionState = types.HostSystemConnectionStateDisconnected
+	standalone := simulator.Map.Get(simulator.Map.Any("ComputeResource").(*mo.ComputeResource).Host[0]).(*simulator.HostSystem)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts.csv")
+	clusterPath := filepath.Join(dir, "clusters.csv")
+	runCollection(t, Configuration{
+		Config: settings.Config{
+			Outpath:        path,
+			ClusterOutpath: clusterPath,
+			Fields:         []string{"Cluster", "Host", "ConnectionState", "TotalCPU", "MemorySize", "FreeMemory"},
+		},
+		VCenters: []*VCenter{vcenter},
+	})
+
+	rows := readRows(t, path)
+	if len(rows) != 4 {
+		t.Fatalf("%d hosts written, want 4 with the disconnected one", len(rows))
+	}
+	for _, row := range rows {
+		switch row["Host"] {
+		case standalone.Name:
+			if row["Cluster"] != "(standalone)" {
+				t.Errorf("standalone host in cluster %q", row["Cluster"])
+			}
+		case disconnected.Name:
+			if row["Cluster"] != cluster.Name || row["ConnectionState"] != "disconnected" {
+				t.Errorf("disconnected host written in cluster %q as %q", row["Cluster"], row["ConnectionState"])
+			}
+			if row["TotalCPU"] != "0" || row["MemorySize"] != "0B" || row["FreeMemory"] != "0B" {
+				t.Errorf("disconnected host has capacity %s MHz and %s with %s free, want none", row["TotalCPU"], row["MemorySize"], row["FreeMemory"])
+			}
+		default:
+			if row["Cluster"] != cluster.Name || row["ConnectionState"] != "connected" || row["TotalCPU"] == "0" {
+				t.Errorf("host %s written in cluster %q as %q with %s MHz", row["Host"], row["Cluster"], row["ConnectionState"], row["TotalCPU"])
+			}
+		}
+	}
+
+	clusters := readRows(t, clusterPath)
+	if len(clusters) != 1 {
+		t.Fatalf("%d clusters written, want only %s", len(clusters), cluster.Name)
+	}
+	if clusters[0]["Cluster"] != cluster.Name || clusters[0]["Hosts"] != "2" {
+		t.Errorf("cluster %s written with %s hosts, want %s with the 2 connected", clusters[0]["Cluster"], clusters[0]["Hosts"], cluster.Name)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+	writers "github.com/BilboTheGreedy/hostStats/output"
+)
+
+// output is one file the host stats are written to, the main output or one of the ExtraOutputs
+type output struct {
+	settings.Output
+
+	columns []string     // column names written, after Fields and ExcludeColumns
+	keep    []int        // index of each written column in the incoming row
+	redact  map[int]bool // written columns whose value is blanked
+	plain   bool         // rows and records are written unchanged
+}
+
+// prepareOutputs builds the main output and the ExtraOutputs. Extra outputs default to the
+// main Format and inherit ExcludeColumns/RedactColumns unless they set their own.
+func (config *Configuration) prepareOutputs() error {
+	outputs := []*output{{Output: settings.Output{
+		Path:           config.Outpath,
+		Format:         config.Format,
+		ExcludeColumns: config.ExcludeColumns,
+		RedactColumns:  config.RedactColumns,
+		Options:        config.OutputOptions,
+	}}}
+	for _, extra := range config.ExtraOutputs {
+		o := output{Output: extra}
+		if o.Format == "" {
+			o.Format = config.Format
+		}
+		if o.ExcludeColumns == nil {
+			o.ExcludeColumns = config.ExcludeColumns
+		}
+		if o.RedactColumns == nil {
+			o.RedactColumns = config.RedactColumns
+		}
+		outputs = append(outputs, &o)
+	}
+
+	columns := config.pick(config.headers)
+	for _, o := range outputs {
+		if o.Path == "" && o.Format != "kafka" {
+			return fmt.Errorf("output without a path")
+		}
+		factory, ok := writers.Lookup(o.Format)
+		if !ok {
+			return fmt.Errorf("unknown output format %q for %s, want one of %s", o.Format, o.name(), strings.Join(writers.Formats(), ", "))
+		}
+		options, err := config.writerOptions(o)
+		if err != nil {
+			return fmt.Errorf("%s: %v", o.name(), err)
+		}
+		o.Options = options
+		// the writer checks its options when made, so bad ones fail here instead of after collecting
+		if _, err := factory(context.Background(), io.Discard, json.RawMessage(o.Options)); err != nil {
+			return fmt.Errorf("%s: %v", o.name(), err)
+		}
+		if err := o.prepare(columns, true); err != nil {
+			return fmt.Errorf("%s: %v", o.name(), err)
+		}
+		o.plain = o.plain && len(config.Fields) == 0
+	}
+	config.outputs = outputs
+
+	return nil
+}
+
+// name is how the output is referred to in errors and logs
+func (o *output) name() string {
+	if o.Format == "kafka" {
+		return "kafka topic " + o.Topic
+	}
+	return o.Path
+}
+
+// writerOptions are the Options of o with the settings kept outside them added: PrettyJSON for json
+// and the Brokers and Topic of kafka. What Options sets itself is kept.
+func (config Configuration) writerOptions(o *output) (settings.RawOptions, error) {
+	added := make(map[string]interface{})
+	switch o.Format {
+	case "json":
+		if config.PrettyJSON {
+			added["Pretty"] = true
+		}
+	case "kafka":
+		added["Brokers"], added["Topic"] = o.Brokers, o.Topic
+	}
+	if len(added) == 0 {
+		return o.Options, nil
+	}
+
+	options := make(map[string]json.RawMessage)
+	if len(bytes.TrimSpace(o.Options)) > 0 {
+		if err := json.Unmarshal(o.Options, &options); err != nil {
+			return nil, fmt.Errorf("invalid %s options: %v", o.Format, err)
+		}
+	}
+	for key, value := range added {
+		if _, ok := options[key]; ok {
+			continue
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		options[key] = b
+	}
+	b, err := json.Marshal(options)
+	return settings.RawOptions(b), err
+}
+
+// tableOutput applies the global column rules to a secondary output, ignoring columns it doesn't have
+func (config Configuration) tableOutput(path string, headers []string) *output {
+	o := &output{Output: settings.Output{Path: path, Format: config.Format, ExcludeColumns: config.ExcludeColumns, RedactColumns: config.RedactColumns, Options: config.OutputOptions}}
+	// the same options as the main output, whose check already passed
+	o.Options, _ = config.writerOptions(o)
+	o.prepare(headers, false)
+	return o
+}
+
+// prepare resolves the rules against the incoming columns, unknown names are an error when strict
+func (o *output) prepare(columns []string, strict bool) error {
+	index := make(map[string]int)
+	for i, column := range columns {
+		index[strings.ToLower(column)] = i
+	}
+	lookup := func(names []string) (map[int]bool, error) {
+		found := make(map[int]bool)
+		for _, name := range names {
+			i, ok := index[strings.ToLower(name)]
+			if !ok {
+				if strict {
+					return nil, fmt.Errorf("unknown column %q", name)
+				}
+				continue
+			}
+			found[i] = true
+		}
+		return found, nil
+	}
+
+	excluded, err := lookup(o.ExcludeColumns)
+	if err != nil {
+		return err
+	}
+	redacted, err := lookup(o.RedactColumns)
+	if err != nil {
+		return err
+	}
+
+	o.columns, o.keep, o.redact = nil, nil, make(map[int]bool)
+	for i, column := range columns {
+		if excluded[i] {
+			continue
+		}
+		if redacted[i] {
+			o.redact[len(o.keep)] = true
+		}
+		o.keep = append(o.keep, i)
+		o.columns = append(o.columns, column)
+	}
+	o.plain = len(excluded) == 0 && len(redacted) == 0
+
+	return nil
+}
+
+// write writes to Path with the writer registered for the output's Format, rows and records hold the same records
+func (o *output) write(rows [][]string, records interface{}) error {
+	written := o.written(rows, records)
+	return writeOutput(o.Path, func(w io.Writer) error {
+		return writers.Write(context.Background(), w, o.Format, json.RawMessage(o.Options), o.columns, written)
+	})
+}
+
+// writeReport writes a json output with ErrorReport, its records under Hosts next to the Errors
+func (o *output) writeReport(rows [][]string, records interface{}, report []errorRecord, pretty bool) error {
+	var hosts bytes.Buffer
+	if err := writers.Write(context.Background(), &hosts, o.Format, json.RawMessage(o.Options), o.columns, o.written(rows, records)); err != nil {
+		return err
+	}
+	return jsonExport(hostReport{Hosts: json.RawMessage(hosts.Bytes()), Errors: report}, o.Path, pretty)
+}
+
+// written are the records as handed to the writer, the text of each row with the record it came from
+func (o *output) written(rows [][]string, records interface{}) []writers.Record {
+	values := reflect.ValueOf(o.records(records))
+	written := make([]writers.Record, len(rows))
+	for i, row := range o.rows(rows) {
+		written[i].Row = row
+		if i < values.Len() {
+			written[i].Value = values.Index(i).Interface()
+		}
+	}
+	return written
+}
+
+// row returns the written columns of a row
+func (o *output) row(row []string) []string {
+	if o.plain {
+		return row
+	}
+	out := make([]string, len(o.keep))
+	for j, i := range o.keep {
+		if !o.redact[j] {
+			out[j] = row[i]
+		}
+	}
+	return out
+}
+
+func (o *output) rows(rows [][]string) [][]string {
+	if o.plain {
+		return rows
+	}
+	out := make([][]string, len(rows))
+	for i, row := range rows {
+		out[i] = o.row(row)
+	}
+	return out
+}
+
+// records returns a slice of structs for JSON output, as objects holding only the written columns.
+// Redacted fields get their type's zero value, label, tag and attribute columns are looked up in the Labels and Tags fields.
+func (o *output) records(records interface{}) interface{} {
+	if o.plain {
+		return records
+	}
+
+	slice := reflect.ValueOf(records)
+	out := make([]map[string]interface{}, 0, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		val := slice.Index(i)
+		record := make(map[string]interface{}, len(o.columns))
+		for j, column := range o.columns {
+			if f := val.FieldByName(column); f.IsValid() {
+				if o.redact[j] {
+					record[column] = reflect.Zero(f.Type()).Interface()
+				} else {
+					record[column] = f.Interface()
+				}
+				continue
+			}
+			value := ""
+			for _, name := range []string{"Labels", "Tags"} {
+				if labels := val.FieldByName(name); labels.IsValid() && !o.redact[j] {
+					if v := labels.MapIndex(reflect.ValueOf(column)); v.IsValid() {
+						value = v.String()
+					}
+				}
+			}
+			record[column] = value
+		}
+		out = append(out, record)
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+	writers "github.com/BilboTheGreedy/hostStats/output"
+)
+
+// options are the command line flags that apply on top of the configuration file
+type options struct {
+	pretty    bool
+	logout    bool
+	only      []string
+	dumpRaw   string
+	countOnly bool
+	daemon    bool
+	interval  settings.Duration
+	force     bool
+	validate  bool
+	noSort    bool
+
+	diff         string
+	diffFormat   string
+	diffVolatile bool
+	delta        string
+}
+
+// readConfig reads the configuration file, its errors name the absolute path it tried
+func readConfig(path string) (Configuration, error) {
+	file, err := settings.Read(path)
+	if err != nil {
+		return Configuration{}, err
+	}
+	return newConfiguration(file), nil
+}
+
+// newConfiguration moves the vcenters of the file to VCenters
+func newConfiguration(file settings.Config) Configuration {
+	config := Configuration{Config: file, VCenters: newVCenters(file.VCenters)}
+	config.Config.VCenters = nil
+	return config
+}
+
+// newVCenters makes the vcenters to collect from vcenter entries
+func newVCenters(entries []*settings.VCenter) []*VCenter {
+	vcenters := make([]*VCenter, len(entries))
+	for i, entry := range entries {
+		vcenters[i] = &VCenter{VCenter: *entry}
+	}
+	return vcenters
+}
+
+// prepare applies the flags, validates the configuration and fills in everything derived from it
+func (config *Configuration) prepare(opts options) error {
+	var err error
+
+	if opts.pretty {
+		config.PrettyJSON = true
+	}
+	config.logout = opts.logout
+	config.dumpRaw = opts.dumpRaw
+	config.countOnly = opts.countOnly
+	config.validateSchema = opts.validate
+	config.noSort = opts.noSort
+	if opts.force {
+		config.Overwrite = true
+	}
+	if config.Format == "" {
+		config.Format = "csv"
+	}
+	if config.Format == "kafka" {
+		return fmt.Errorf("kafka only works as an entry of ExtraOutputs, not as the main Format")
+	}
+	if _, ok := writers.Lookup(config.Format); !ok {
+		return fmt.Errorf("unknown output format %q, want one of %s", config.Format, strings.Join(writers.Formats(), ", "))
+	}
+	config.diff, config.diffFormat, config.diffVolatile = opts.diff, opts.diffFormat, opts.diffVolatile
+	config.diffBase = config.Outpath
+	config.delta = opts.delta
+	if config.diffFormat == "" {
+		config.diffFormat = "markdown"
+	}
+	if config.diffFormat != "csv" && config.diffFormat != "json" && config.diffFormat != "markdown" {
+		return fmt.Errorf("unknown diff format %q", config.diffFormat)
+	}
+	if opts.interval > 0 {
+		config.Interval = opts.interval
+		config.TimestampOutput = true
+	}
+	if config.ConnectDelay == 0 {
+		config.ConnectDelay = config.WorkerStartDelay
+	}
+	if err := config.prepareSchedule(opts.daemon); err != nil {
+		return err
+	}
+
+	if err := config.loadVCentersFile(); err != nil {
+		return err
+	}
+	if err := config.rejectDuplicateVCenters(); err != nil {
+		return err
+	}
+
+	config.labelKeys, err = labelKeys(config.VCenters)
+	if err != nil {
+		return fmt.Errorf("invalid labels: %v", err)
+	}
+
+	if config.AverageVM != nil {
+		if err := config.AverageVM.Validate(); err != nil {
+			return fmt.Errorf("invalid AverageVM: %v", err)
+		}
+	}
+
+	if config.SiteRegex != "" {
+		config.siteRegex, err = regexp.Compile(config.SiteRegex)
+		if err == nil && config.siteRegex.SubexpIndex("site") < 0 {
+			err = fmt.Errorf("missing named capture group (?P<site>...)")
+		}
+		if err != nil {
+			return fmt.Errorf("invalid SiteRegex: %v", err)
+		}
+	}
+
+	config.VCenters, err = selectVCenters(config.VCenters, opts.only)
+	if err != nil {
+		return err
+	}
+
+	var Data hostStat
+	for _, name := range append(config.TagCategories, config.CustomAttributes...) {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("empty tag category or custom attribute name")
+		}
+	}
+	config.headers = append(hostStat.Headers(Data), config.labelKeys...)
+	config.headers = append(config.headers, config.tagColumns()...)
+	if err := config.selectFields(config.headers); err != nil {
+		return fmt.Errorf("invalid Fields: %v", err)
+	}
+
+	if err := config.prepareOutputs(); err != nil {
+		return fmt.Errorf("invalid output: %v", err)
+	}
+	if err := config.prepareAlerts(); err != nil {
+		return fmt.Errorf("invalid Alerts: %v", err)
+	}
+	if err := config.prepareSort(); err != nil {
+		return fmt.Errorf("invalid SortBy: %v", err)
+	}
+	if err := config.checkOutpaths(); err != nil {
+		return fmt.Errorf("invalid output path: %v", err)
+	}
+	if err := config.checkStdout(); err != nil {
+		return fmt.Errorf("invalid output path: %v", err)
+	}
+
+	return nil
+}
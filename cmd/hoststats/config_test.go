@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+func TestCheckOutputDirs(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	readOnly := filepath.Join(dir, "read-only")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		outpath string
+		fails   bool
+	}{
+		{"writable", filepath.Join(dir, "hosts.csv"), false},
+		{"missing directory", filepath.Join(dir, "missing", "hosts.csv"), true},
+		{"file as directory", filepath.Join(file, "hosts.csv"), true},
+		{"read-only directory", filepath.Join(readOnly, "hosts.csv"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "read-only directory" && os.Geteuid() == 0 {
+				t.Skip("root can write to a read-only directory")
+			}
+			config := Configuration{Config: settings.Config{Outpath: tt.outpath}}
+			if err := config.prepare(options{}); err != nil {
+				t.Fatal(err)
+			}
+			err := config.checkOutputDirs()
+			if tt.fails && err == nil {
+				t.Errorf("no error for %s", tt.outpath)
+			} else if !tt.fails && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("checking left %d entries in the directory, want the 2 made here", len(entries))
+	}
+}
+
+// a run with an output that can't be written fails before connecting to any vcenter
+func TestUnwritableOutputFailsBeforeConnecting(t *testing.T) {
+	vcenter := soapProxy(t, newSimulator(t, nil), func(method string, w http.ResponseWriter, r *http.Request) bool {
+		t.Errorf("%s called on the vcenter", method)
+		return true
+	})
+	summary := runCollection(t, Configuration{
+		Config: settings.Config{
+			Outpath: filepath.Join(t.TempDir(), "missing", "hosts.csv"),
+		},
+		VCenters: []*VCenter{vcenter},
+	})
+	if summary.ExitCode != 1 {
+		t.Errorf("exit code %d, want 1", summary.ExitCode)
+	}
+}
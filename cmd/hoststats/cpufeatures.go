@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/vmware/govmomi/vim25/mo"
+)
+
+// cpuFeatureStat is one CPUID level reported by a host, the registers are bit strings as reported by vcenter
+type cpuFeatureStat struct {
+	Host   string
+	Level  int32
+	Vendor string
+	Eax    string
+	Ebx    string
+	Ecx    string
+	Edx    string
+}
+
+func (r cpuFeatureStat) Headers() []string {
+	var res []string
+	t := reflect.TypeOf(r)
+	for i := 0; i < t.NumField(); i++ {
+		res = append(res, t.Field(i).Name)
+	}
+	return res
+}
+
+func (r cpuFeatureStat) Slice() []string {
+	return []string{
+		r.Host,
+		strconv.FormatInt(int64(r.Level), 10),
+		r.Vendor,
+		r.Eax,
+		r.Ebx,
+		r.Ecx,
+		r.Edx,
+	}
+}
+
+// hostCPUFeatures lists the CPUID feature levels of a host, none when the hardware info is missing
+func hostCPUFeatures(host string, hs mo.HostSystem) []cpuFeatureStat {
+	if hs.Hardware == nil {
+		return nil
+	}
+
+	var features []cpuFeatureStat
+	for _, f := range hs.Hardware.CpuFeature {
+		features = append(features, cpuFeatureStat{
+			Host:   host,
+			Level:  f.Level,
+			Vendor: f.Vendor,
+			Eax:    f.Eax,
+			Ebx:    f.Ebx,
+			Ecx:    f.Ecx,
+			Edx:    f.Edx,
+		})
+	}
+
+	return features
+}
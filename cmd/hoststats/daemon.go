@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// runDaemon collects from all vcenters every Interval, or at the times of the
+// cron Schedule, until quit is closed. Cycles never overlap: runs missed while
+// a cycle was still going are skipped. Closing quit lets the running cycle
+// finish and flush its outputs, cancelling ctx aborts it.
+func runDaemon(ctx context.Context, reloader *configReloader, quit <-chan struct{}) int {
+	reloader.watch()
+	systemd := newSystemdNotifier()
+	systemd.watch(quit)
+	defer systemd.notify("STOPPING=1")
+	pool := newClientPool()
+	defer pool.Close()
+
+	config := reloader.current()
+	api := newAPIServer(reloader)
+	api.start()
+	defer api.stop()
+	if config.schedule != nil {
+		next := config.nextRun(time.Now())
+		slog.Info("first collection scheduled", "next", next.Format(time.RFC3339))
+		systemd.notify("STATUS=First collection scheduled at " + next.Format(time.RFC3339))
+		if !sleepUntil(next, quit, api.triggered()) {
+			return 0
+		}
+	}
+
+	for cycle := 1; ; cycle++ {
+		config = reloader.current()
+		config.pool = pool
+		pool.prune(ctx, config.VCenters)
+
+		slog.Info("starting collection cycle", "cycle", cycle)
+		start := time.Now()
+		api.started(start)
+		if config.TimestampOutput {
+			config.stampOutputs(start)
+		}
+		systemd.cycleStarted(cycle)
+		summary := collect(ctx, config, false)
+		code := summary.ExitCode
+		slog.Info("collection cycle finished", "cycle", cycle, "duration", time.Since(start).Round(time.Second), "code", code)
+		systemd.cycleDone(cycle, code, summary.Hosts, time.Since(start))
+		api.update(config, summary, time.Now())
+
+		next := reloader.current().nextRun(start)
+		select {
+		case <-quit:
+			if ctx.Err() != nil {
+				return exitShutdown
+			}
+			return 0
+		default:
+		}
+		slog.Info("next collection scheduled", "next", next.Format(time.RFC3339))
+		if !sleepUntil(next, quit, api.triggered()) {
+			return 0
+		}
+	}
+}
+
+// sleepUntil waits for t or until a run is triggered, it returns false when quit is closed first
+func sleepUntil(t time.Time, quit <-chan struct{}, trigger <-chan struct{}) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-quit:
+		return false
+	case <-trigger:
+		slog.Info("collection triggered through the api")
+		return true
+	case <-timer.C:
+		return true
+	}
+}
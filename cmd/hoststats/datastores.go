@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// localSpace sums up the local datastores attached to a host
+type localSpace struct {
+	count    int
+	capacity int64
+	free     int64
+}
+
+// localDatastores returns the local datastore space per host, by moref value.
+// A datastore is local when vcenter reports it is not accessible from multiple hosts,
+// hosts without one are missing from the map. All datastores are looked up in one call.
+func localDatastores(ctx context.Context, pc *property.Collector, hss []mo.HostSystem) (map[string]localSpace, error) {
+	local := make(map[string]localSpace)
+
+	seen := make(map[types.ManagedObjectReference]bool)
+	var refs []types.ManagedObjectReference
+	for _, hs := range hss {
+		for _, ref := range hs.Datastore {
+			if !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+	if len(refs) == 0 {
+		return local, nil
+	}
+
+	var dss []mo.Datastore
+	if err := pc.Retrieve(ctx, refs, []string{"summary"}, &dss); err != nil {
+		return nil, err
+	}
+	summaries := make(map[types.ManagedObjectReference]types.DatastoreSummary)
+	for _, ds := range dss {
+		shared := ds.Summary.MultipleHostAccess
+		if shared == nil || *shared {
+			continue
+		}
+		summaries[ds.Reference()] = ds.Summary
+	}
+
+	for _, hs := range hss {
+		for _, ref := range hs.Datastore {
+			summary, ok := summaries[ref]
+			if !ok {
+				continue
+			}
+			space := local[hs.Reference().Value]
+			space.count++
+			space.capacity += summary.Capacity
+			space.free += summary.FreeSpace
+			local[hs.Reference().Value] = space
+		}
+	}
+
+	return local, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// workerState is what a worker is doing right now, for /debug/workers
+type workerState struct {
+	Worker  int
+	VCenter string `json:",omitempty"`
+	Phase   string
+	Since   time.Time
+	Elapsed string
+}
+
+// workerTracker follows the workers of the running collection
+type workerTracker struct {
+	mu      sync.Mutex
+	workers map[int]workerState
+}
+
+var workers = &workerTracker{workers: make(map[int]workerState)}
+
+// set records that worker id entered phase on vcenter, an empty phase means the worker is idle
+func (t *workerTracker) set(id int, vcenter, phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if phase == "" {
+		delete(t.workers, id)
+		return
+	}
+	t.workers[id] = workerState{Worker: id, VCenter: vcenter, Phase: phase, Since: time.Now()}
+}
+
+func (t *workerTracker) snapshot() []workerState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	states := make([]workerState, 0, len(t.workers))
+	for _, state := range t.workers {
+		state.Elapsed = time.Since(state.Since).Round(time.Millisecond).String()
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Worker < states[j].Worker })
+	return states
+}
+
+// debugState is the body of /debug/workers
+type debugState struct {
+	Goroutines int
+	HeapAlloc  uint64
+	HeapInuse  uint64
+	Sys        uint64
+	NumGC      uint32
+	Workers    []workerState
+}
+
+func serveWorkers(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	writeJSON(w, debugState{
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  mem.HeapAlloc,
+		HeapInuse:  mem.HeapInuse,
+		Sys:        mem.Sys,
+		NumGC:      mem.NumGC,
+		Workers:    workers.snapshot(),
+	})
+}
+
+// debugAddress binds to localhost when address has no host, ":6060" and "6060" listen on 127.0.0.1:6060
+func debugAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return net.JoinHostPort("127.0.0.1", address)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// startDebugServer serves net/http/pprof under /debug/pprof/ and the worker state under /debug/workers.
+// It has no authentication, so it only listens on another interface than localhost when asked to.
+func startDebugServer(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/workers", serveWorkers)
+	server := &http.Server{Addr: debugAddress(address), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		slog.Info("serving debug endpoints", "address", server.Addr)
+		if err := server.ListenAndServe(); err != nil {
+			slog.Error("could not serve debug endpoints", "address", server.Addr, "error", err)
+		}
+	}()
+}
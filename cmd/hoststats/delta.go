@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/govmomi/units"
+)
+
+// sizeSyntax reads back sizes as written in csv, like 12.0GB, or a plain number of bytes as in json
+var sizeSyntax = regexp.MustCompile(`^(-?[0-9]+(?:\.[0-9]+)?)(B|KB|MB|GB|TB|PB|EB)?$`)
+
+var sizeUnits = map[string]float64{"": 1, "B": 1, "KB": units.KB, "MB": units.MB, "GB": units.GB, "TB": units.TB, "PB": units.PB, "EB": units.EB}
+
+func parseSize(s string) (int64, error) {
+	m := sizeSyntax.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(n * sizeUnits[m[2]]), nil
+}
+
+// signedSize formats a size that can be negative, units.ByteSize only scales positive ones
+func signedSize(n int64) string {
+	if n < 0 {
+		return "-" + units.ByteSize(-n).String()
+	}
+	return units.ByteSize(n).String()
+}
+
+// deltas are the changes in FreeCPU and FreeMemory since the -delta output, nil when the host
+// or the column isn't in it
+func (config Configuration) deltas(s hostStat) (cpu, memory *int64) {
+	if config.deltaBase == nil {
+		return nil, nil
+	}
+	previous, ok := config.deltaBase.rows[hostKey(s.VCenter, s.Host)]
+	if !ok {
+		return nil, nil
+	}
+	if v, err := strconv.ParseInt(previous["FreeCPU"], 10, 64); err == nil {
+		d := s.FreeCPU - v
+		cpu = &d
+	}
+	if v, err := parseSize(previous["FreeMemory"]); err == nil {
+		d := freeMemory(s, previous["FreeMemory"]) - v
+		memory = &d
+	}
+	return cpu, memory
+}
+
+// freeMemory is the FreeMemory of s rounded like previous, a csv size is rounded to a tenth of its
+// unit, so an unchanged host would otherwise get a delta of the rounding
+func freeMemory(s hostStat, previous string) int64 {
+	if _, err := strconv.ParseInt(strings.TrimSpace(previous), 10, 64); err == nil {
+		return s.FreeMemory
+	}
+	rounded, err := parseSize(signedSize(s.FreeMemory))
+	if err != nil {
+		return s.FreeMemory
+	}
+	return rounded
+}
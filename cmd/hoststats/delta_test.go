@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+	"github.com/vmware/govmomi/units"
+)
+
+func TestMemoryDelta(t *testing.T) {
+	const free = 1503238554 // 1.4GB
+	tests := []struct {
+		previous string
+		want     int64
+	}{
+		// an unchanged host written in csv
+		{"1.4GB", 0},
+		{units.ByteSize(free).String(), 0},
+		// json keeps the bytes
+		{"1503238554", 0},
+		{"1503238000", 554},
+		// both sides rounded to 1.4GB and 2.0GB
+		{"2.0GB", 1503238553 - 2*units.GB},
+	}
+	for _, tt := range tests {
+		config := Configuration{deltaBase: &hostTable{rows: map[string]map[string]string{
+			hostKey("vc", "esx-01"): {"FreeCPU": "100", "FreeMemory": tt.previous},
+		}}}
+		_, memory := config.deltas(hostStat{VCenter: "vc", Host: "esx-01", FreeCPU: 100, FreeMemory: free})
+		if memory == nil {
+			t.Errorf("no delta from %s", tt.previous)
+		} else if *memory != tt.want {
+			t.Errorf("delta from %s is %d, want %d", tt.previous, *memory, tt.want)
+		}
+	}
+}
+
+// a csv output written with a Comma is read back with it for the deltas
+func TestDeltaWithComma(t *testing.T) {
+	vcenter := newSimulator(t, nil)
+	dir := t.TempDir()
+	semicolon := settings.RawOptions(`{"Comma": ";"}`)
+	previous := filepath.Join(dir, "previous.csv")
+	runCollection(t, Configuration{Config: settings.Config{Outpath: previous, OutputOptions: semicolon}, VCenters: []*VCenter{vcenter}})
+
+	path := filepath.Join(dir, "hosts.csv")
+	config := Configuration{Config: settings.Config{Outpath: path, OutputOptions: semicolon}, VCenters: []*VCenter{vcenter}}
+	if err := config.prepare(options{delta: previous}); err != nil {
+		t.Fatal(err)
+	}
+	collect(context.Background(), config, false)
+
+	header, rows, err := readCSV([]byte(readFile(t, path)), ';')
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta := -1
+	for i, column := range header {
+		if column == "FreeCpuDelta" {
+			delta = i
+		}
+	}
+	if delta < 0 || len(rows) != 4 {
+		t.Fatalf("%d rows with columns %v, want 4 with FreeCpuDelta", len(rows), header)
+	}
+	for _, row := range rows {
+		if row[delta] == "" {
+			t.Errorf("host %v has no FreeCpuDelta, the previous output was not read", row)
+		}
+	}
+}
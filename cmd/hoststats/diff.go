@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	writers "github.com/BilboTheGreedy/hostStats/output"
+)
+
+// volatileColumns change on every run and are left out of the diff unless -diff-volatile is given
+var volatileColumns = map[string]bool{
+	"FreeCPU":             true,
+	"FreeMemory":          true,
+	"OverallMemoryUsage":  true,
+	"LocalDatastoreFree":  true,
+	"ProvisionedVCPU":     true,
+	"VcpuOvercommitRatio": true,
+	"FreeCpuDelta":        true,
+	"FreeMemoryDelta":     true,
+	"EstimatedFreeVMs":    true,
+	"CpuUsagePercent":     true,
+	"MemoryUsagePercent":  true,
+}
+
+// hostTable is an output read back as text, keyed by vcenter and host
+type hostTable struct {
+	columns []string
+	rows    map[string]map[string]string
+}
+
+func hostKey(vcenter, host string) string {
+	return vcenter + "/" + host
+}
+
+// hostChange is one line of the diff report, Field is empty for added and removed hosts
+type hostChange struct {
+	Change  string
+	VCenter string
+	Host    string
+	Field   string `json:",omitempty"`
+	Old     string `json:",omitempty"`
+	New     string `json:",omitempty"`
+}
+
+// previousOutput is the file named by -diff or -delta, auto picks the newest earlier output of the main Outpath
+func (config Configuration) previousOutput(spec string) (string, error) {
+	if spec != "auto" {
+		return spec, nil
+	}
+
+	patterns := []string{timeGlob(config.diffBase)}
+	if config.TimestampOutput {
+		ext := filepath.Ext(config.diffBase)
+		patterns = append(patterns, strings.TrimSuffix(patterns[0], ext)+"-*"+ext)
+	}
+
+	var newest string
+	var newestTime time.Time
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", err
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || info.IsDir() || isReport(match) {
+				continue
+			}
+			if info.ModTime().After(newestTime) {
+				newest, newestTime = match, info.ModTime()
+			}
+		}
+	}
+	return newest, nil
+}
+
+// isReport tells the files written next to an output apart from outputs matching the same pattern
+func isReport(path string) bool {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, suffix := range []string{".diff", ".errors", ".summary"} {
+		if strings.HasSuffix(base, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeGlob turns the time tokens of an output path into wildcards
+func timeGlob(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '%' && i+1 < len(path) {
+			i++
+			if path[i] == '%' {
+				b.WriteByte('%')
+			} else {
+				b.WriteByte('*')
+			}
+			continue
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// csvComma is the separator of the main output, which -diff and -delta read back. Only a csv output has one,
+// its options passed the check of the csv writer.
+func (config Configuration) csvComma() rune {
+	if config.Format != "csv" {
+		return ','
+	}
+	comma, _ := writers.CSVComma(json.RawMessage(config.OutputOptions))
+	return comma
+}
+
+// readPrevious loads the output named by spec before this run replaces it, nil when there is none
+func (config Configuration) readPrevious(spec, phase string) (*hostTable, string) {
+	if spec == "" || config.countOnly {
+		return nil, ""
+	}
+	path, err := config.previousOutput(spec)
+	if err == nil && path == "" {
+		slog.Info("no previous output to compare with", "phase", phase, "path", config.diffBase)
+		return nil, ""
+	}
+	var table *hostTable
+	if err == nil {
+		table, err = readHostTable(path, config.csvComma())
+	}
+	if err != nil {
+		slog.Error("could not read previous output", "phase", phase, "path", path, "error", err)
+		return nil, ""
+	}
+	return table, path
+}
+
+// readHostTable reads a csv output separated by comma or a json output, json is told apart by the extension
+func readHostTable(path string, comma rune) (*hostTable, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return jsonHostTable(b)
+	}
+
+	columns, rows, err := readCSV(b, comma)
+	if err != nil {
+		return nil, err
+	}
+	return newHostTable(columns, rows)
+}
+
+// readCSV splits a csv output separated by comma into its header and rows
+func readCSV(b []byte, comma rune) ([]string, [][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(b))
+	reader.Comma = comma
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("no header")
+	}
+	return records[0], records[1:], nil
+}
+
+// jsonHostTable reads host records, as a plain array or under Hosts as written with ErrorReport
+func jsonHostTable(b []byte) (*hostTable, error) {
+	var hosts []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&hosts); err != nil {
+		var report struct{ Hosts []map[string]interface{} }
+		decoder = json.NewDecoder(bytes.NewReader(b))
+		decoder.UseNumber()
+		if err := decoder.Decode(&report); err != nil {
+			return nil, err
+		}
+		hosts = report.Hosts
+	}
+
+	seen := make(map[string]bool)
+	var columns []string
+	for _, host := range hosts {
+		for column := range host {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	sort.Strings(columns)
+	var rows [][]string
+	for _, host := range hosts {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			if v, ok := host[column]; ok && v != nil {
+				row[i] = fmt.Sprint(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return newHostTable(columns, rows)
+}
+
+func newHostTable(columns []string, rows [][]string) (*hostTable, error) {
+	vcenter, host := -1, -1
+	for i, column := range columns {
+		switch column {
+		case "VCenter":
+			vcenter = i
+		case "Host":
+			host = i
+		}
+	}
+	if vcenter < 0 || host < 0 {
+		return nil, fmt.Errorf("the VCenter and Host columns are needed to match hosts")
+	}
+
+	table := &hostTable{columns: columns, rows: make(map[string]map[string]string)}
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			continue
+		}
+		values := make(map[string]string, len(columns))
+		for i, column := range columns {
+			values[column] = row[i]
+		}
+		table.rows[hostKey(row[vcenter], row[host])] = values
+	}
+	return table, nil
+}
+
+// currentHostTable is this run's main output as it was written, in the format of the previous file
+func (config Configuration) currentHostTable(previous string) (*hostTable, error) {
+	o := config.outputs[0]
+	if strings.EqualFold(filepath.Ext(previous), ".json") {
+		var stats []hostStat
+		for _, vcenter := range config.VCenters {
+			stats = append(stats, vcenter.stats...)
+		}
+		b, err := json.Marshal(o.records(stats))
+		if err != nil {
+			return nil, err
+		}
+		return jsonHostTable(b)
+	}
+
+	var rows [][]string
+	for _, vcenter := range config.VCenters {
+		rows = append(rows, vcenter.Data...)
+	}
+	return newHostTable(o.columns, o.rows(rows))
+}
+
+// diffHosts lists the hosts added and removed and the changed fields of the others, sorted by host
+func diffHosts(previous, current *hostTable, volatile bool) []hostChange {
+	var keys []string
+	for key := range previous.rows {
+		keys = append(keys, key)
+	}
+	for key := range current.rows {
+		if _, ok := previous.rows[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []hostChange{}
+	for _, key := range keys {
+		old, wasThere := previous.rows[key]
+		now, isThere := current.rows[key]
+		switch {
+		case !wasThere:
+			changes = append(changes, hostChange{Change: "added", VCenter: now["VCenter"], Host: now["Host"]})
+		case !isThere:
+			changes = append(changes, hostChange{Change: "removed", VCenter: old["VCenter"], Host: old["Host"]})
+		default:
+			for _, column := range current.columns {
+				if volatileColumns[column] && !volatile {
+					continue
+				}
+				before, ok := old[column]
+				if !ok || before == now[column] {
+					continue
+				}
+				changes = append(changes, hostChange{Change: "changed", VCenter: now["VCenter"], Host: now["Host"], Field: column, Old: before, New: now[column]})
+			}
+		}
+	}
+	return changes
+}
+
+// diffPath is the report next to the main output, hosts.csv gets hosts.diff.md for markdown
+func (config Configuration) diffPath() string {
+	ext := map[string]string{"csv": ".csv", "json": ".json", "markdown": ".md"}[config.diffFormat]
+	path := config.outputs[0].Path
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".diff" + ext
+}
+
+// writeDiff compares the run with previous and writes the change report
+func (config Configuration) writeDiff(previous *hostTable, previousPath string) {
+	current, err := config.currentHostTable(previousPath)
+	if err != nil {
+		slog.Error("could not compare with the previous run", "phase", "diff", "error", err)
+		return
+	}
+	changes := diffHosts(previous, current, config.diffVolatile)
+
+	path := config.diffPath()
+	switch config.diffFormat {
+	case "json":
+		err = jsonExport(changes, path, config.PrettyJSON)
+	case "markdown":
+		err = replaceWith(path, outputMode, func(w io.Writer) error {
+			writeMarkdownDiff(w, changes, previousPath)
+			return nil
+		})
+	default:
+		var rows [][]string
+		for _, c := range changes {
+			rows = append(rows, []string{c.Change, c.VCenter, c.Host, c.Field, c.Old, c.New})
+		}
+		err = csvExport([]string{"Change", "VCenter", "Host", "Field", "Old", "New"}, rows, path, nil)
+	}
+	if err != nil {
+		slog.Error("could not write diff", "phase", "diff", "path", path, "error", err)
+		return
+	}
+	slog.Info("diff saved", "phase", "diff", "path", path, "previous", previousPath, "changes", len(changes))
+}
+
+func writeMarkdownDiff(w io.Writer, changes []hostChange, previous string) {
+	fmt.Fprintf(w, "# Changes since %s\n", previous)
+	sections := []struct{ change, title string }{{"added", "New hosts"}, {"removed", "Removed hosts"}, {"changed", "Changed hosts"}}
+	cell := strings.NewReplacer("|", `\|`, "\n", " ")
+	for _, section := range sections {
+		var lines []hostChange
+		for _, c := range changes {
+			if c.Change == section.change {
+				lines = append(lines, c)
+			}
+		}
+		fmt.Fprintf(w, "\n## %s (%d)\n\n", section.title, len(lines))
+		if len(lines) == 0 {
+			fmt.Fprintln(w, "None.")
+			continue
+		}
+		if section.change != "changed" {
+			for _, c := range lines {
+				fmt.Fprintf(w, "- %s on %s\n", cell.Replace(c.Host), cell.Replace(c.VCenter))
+			}
+			continue
+		}
+		fmt.Fprintln(w, "| VCenter | Host | Field | Old | New |")
+		fmt.Fprintln(w, "|---|---|---|---|---|")
+		for _, c := range lines {
+			fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n", cell.Replace(c.VCenter), cell.Replace(c.Host), c.Field, cell.Replace(c.Old), cell.Replace(c.New))
+		}
+	}
+}
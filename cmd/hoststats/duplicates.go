@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// maxDuplicatesLogged caps the names listed in the duplicate host warning
+const maxDuplicatesLogged = 10
+
+// duplicateHosts returns the host names, compared case insensitively, that more than one host has,
+// with the number of hosts of each. Linked vcenters or two vcenters can each have a host of the same name.
+func duplicateHosts(stats []hostStat) map[string]int {
+	counts := make(map[string]int)
+	names := make(map[string]string)
+	for _, s := range stats {
+		key := strings.ToLower(s.Host)
+		counts[key]++
+		if _, ok := names[key]; !ok {
+			names[key] = s.Host
+		}
+	}
+	duplicates := make(map[string]int)
+	for key, n := range counts {
+		if n > 1 {
+			duplicates[names[key]] = n
+		}
+	}
+	return duplicates
+}
+
+// warnDuplicateHosts logs the host names collected more than once, VCenter and MoRef tell them apart
+func warnDuplicateHosts(stats []hostStat) {
+	duplicates := duplicateHosts(stats)
+	if len(duplicates) == 0 {
+		return
+	}
+	var names []string
+	hosts := 0
+	for name, n := range duplicates {
+		names = append(names, name)
+		hosts += n
+	}
+	sort.Strings(names)
+	if len(names) > maxDuplicatesLogged {
+		names = append(names[:maxDuplicatesLogged], "...")
+	}
+	slog.Warn("host names collected more than once, tell them apart by VCenter and MoRef or set DeduplicateHosts", "phase", "collect",
+		"names", len(duplicates), "hosts", hosts, "examples", strings.Join(names, ","))
+}
+
+// dedupeHosts keeps the first host of every name, compared case insensitively, and its row.
+// The vcenters are in configuration order, so the vcenter listed first wins.
+func dedupeHosts(stats []hostStat, rows [][]string) ([]hostStat, [][]string) {
+	if len(stats) != len(rows) {
+		return stats, rows
+	}
+	seen := make(map[string]bool)
+	var keptStats []hostStat
+	var keptRows [][]string
+	for i, s := range stats {
+		key := strings.ToLower(s.Host)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keptStats = append(keptStats, s)
+		keptRows = append(keptRows, rows[i])
+	}
+	if dropped := len(stats) - len(keptStats); dropped > 0 {
+		slog.Info("dropped hosts already collected from another vcenter", "phase", "collect", "hosts", dropped)
+	}
+	return keptStats, keptRows
+}
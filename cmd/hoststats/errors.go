@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// collectError is why a vcenter failed, with the phase it failed in and a category for reports
+type collectError struct {
+	Phase     string
+	Category  string
+	Retryable bool
+	err       error
+}
+
+func (e *collectError) Error() string { return e.err.Error() }
+func (e *collectError) Unwrap() error { return e.err }
+
+// classify wraps err with the phase it happened in and its category
+func classify(phase string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var c *collectError
+	if errors.As(err, &c) {
+		return err
+	}
+	category := errorCategory(err)
+	return &collectError{Phase: phase, Category: category, Retryable: retryableCategory(category), err: err}
+}
+
+// retryableCategory reports whether errors of category may go away on their own, like timeouts and network errors
+func retryableCategory(category string) bool {
+	return category == "timeout" || category == "network"
+}
+
+// retryable reports whether the vcenter failed with an error that may go away when collected again
+func retryable(err error) bool {
+	var c *collectError
+	if errors.As(err, &c) {
+		return c.Retryable
+	}
+	return err != nil && retryableCategory(errorCategory(err))
+}
+
+// errorCategory sorts an error into dns, tls, auth, permission, timeout, network, canceled or other
+func errorCategory(err error) string {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		var fault interface{}
+		switch {
+		case soap.IsSoapFault(e):
+			fault = soap.ToSoapFault(e).VimFault()
+		case soap.IsVimFault(e):
+			fault = soap.ToVimFault(e)
+		}
+		switch fault.(type) {
+		case *types.InvalidLogin, types.InvalidLogin, *types.NotAuthenticated, types.NotAuthenticated:
+			return "auth"
+		case *types.NoPermission, types.NoPermission:
+			return "permission"
+		}
+	}
+
+	var dnsErr *net.DNSError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var verification *tls.CertificateVerificationError
+	var header tls.RecordHeaderError
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTimeout {
+			return "timeout"
+		}
+		return "dns"
+	case errors.As(err, &unknownAuthority), errors.As(err, &hostname), errors.As(err, &invalid),
+		errors.As(err, &verification), errors.As(err, &header):
+		return "tls"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &opErr):
+		return "network"
+	}
+	// login and permission faults that lost their type on the way up
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "incorrect user name or password"), strings.Contains(msg, "not authenticated"):
+		return "auth"
+	case strings.Contains(msg, "permission"):
+		return "permission"
+	}
+	return "other"
+}
+
+// errorRecord is one failed vcenter in the error report
+type errorRecord struct {
+	VCenter   string
+	Hostname  string
+	Phase     string
+	Category  string
+	Message   string
+	Retries   int
+	Retryable bool
+}
+
+func (r errorRecord) Headers() []string {
+	return []string{"VCenter", "Hostname", "Phase", "Category", "Message", "Retries", "Retryable"}
+}
+
+func (r errorRecord) Slice() []string {
+	return []string{r.VCenter, r.Hostname, r.Phase, r.Category, r.Message, strconv.Itoa(r.Retries), strconv.FormatBool(r.Retryable)}
+}
+
+// errorReport lists the vcenters that failed, in configuration order
+func (config Configuration) errorReport() []errorRecord {
+	records := []errorRecord{}
+	for _, vcenter := range config.VCenters {
+		if vcenter.err == nil {
+			continue
+		}
+		record := errorRecord{
+			VCenter:   vcenter.DisplayName(),
+			Hostname:  vcenter.Hostname,
+			Category:  errorCategory(vcenter.err),
+			Message:   redact(vcenter.err.Error()),
+			Retries:   vcenter.retries,
+			Retryable: retryable(vcenter.err),
+		}
+		var c *collectError
+		if errors.As(vcenter.err, &c) {
+			record.Phase = c.Phase
+			record.Category = c.Category
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// errorsPath is the error report next to a csv output, hosts.csv gets hosts.errors.csv
+func errorsPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".errors.csv"
+}
+
+// hostReport is the JSON output with ErrorReport set, the hosts with the failed vcenters
+type hostReport struct {
+	Hosts  interface{}
+	Errors []errorRecord
+}
+
+// writeErrors writes the error report as csv, only the header when no vcenter failed
+func (config Configuration) writeErrors(path string, report []errorRecord) {
+	var rows [][]string
+	for _, r := range report {
+		rows = append(rows, r.Slice())
+	}
+	if err := csvExport(errorRecord{}.Headers(), rows, path, nil); err != nil {
+		slog.Error("could not write error report", "phase", "write", "path", path, "error", err)
+		return
+	}
+	slog.Info("error report saved", "phase", "write", "path", path, "errors", len(report))
+}
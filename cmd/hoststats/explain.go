@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"text/tabwriter"
+)
+
+// fieldMeta documents a hostStat field for -explain: where it is read from, its unit in the JSON output
+// and whether a higher or lower value is better, empty when neither is
+type fieldMeta struct {
+	source string
+	unit   string
+	better string
+}
+
+// fieldMetas has an entry for every hostStat field, the sources are HostSystem property paths
+var fieldMetas = map[string]fieldMeta{
+	"Datacenter":             {"name of the Datacenter above parent, through any host folders", "", ""},
+	"Cluster":                {"parent.name, (standalone) for hosts outside a cluster", "", ""},
+	"Host":                   {"summary.config.name, the MoRef when the host never connected", "", ""},
+	"Version":                {"config.product.version", "", ""},
+	"Build":                  {"config.product.build", "", ""},
+	"FullVersion":            {"config.product.fullName and the update level from config.option[Misc.HostAgentUpdateLevel]", "", ""},
+	"Vendor":                 {"hardware.systemInfo.vendor", "", ""},
+	"Model":                  {"hardware.systemInfo.model", "", ""},
+	"NumCpuPkgs":             {"summary.hardware.numCpuPkgs", "sockets", ""},
+	"NumCpuCores":            {"summary.hardware.numCpuCores", "cores", "higher"},
+	"NumCpuThreads":          {"summary.hardware.numCpuThreads", "threads", "higher"},
+	"CpuModel":               {"summary.hardware.cpuModel", "", ""},
+	"TotalCPU":               {"summary.hardware.cpuMhz × numCpuCores", "MHz", "higher"},
+	"FreeCPU":                {"TotalCPU - summary.quickStats.overallCpuUsage, 0 when the host uses all of it", "MHz", "higher"},
+	"CpuUsagePercent":        {"summary.quickStats.overallCpuUsage / TotalCPU, above 100 with turbo boost", "%", "lower"},
+	"OverallMemoryUsage":     {"summary.quickStats.overallMemoryUsage", "bytes", "lower"},
+	"MemorySize":             {"summary.hardware.memorySize", "bytes", "higher"},
+	"MemorySizeBytes":        {"summary.hardware.memorySize, only written with MemorySizeBytes", "bytes", "higher"},
+	"FreeMemory":             {"summary.hardware.memorySize - summary.quickStats.overallMemoryUsage, 0 when the host uses all of it", "bytes", "higher"},
+	"MemoryUsagePercent":     {"summary.quickStats.overallMemoryUsage / summary.hardware.memorySize", "%", "lower"},
+	"NtpServers":             {"config.dateTimeInfo.ntpConfig.server", "", ""},
+	"NtpRunning":             {"config.service.service[ntpd].running", "", "true"},
+	"VCenter":                {"Name of the vcenter in the configuration, or its Hostname", "", ""},
+	"Site":                   {"SiteRegex applied to Host", "", ""},
+	"MaintenanceMode":        {"summary.runtime.inMaintenanceMode", "", ""},
+	"MaintenanceState":       {"summary.runtime.inMaintenanceMode and recentTask: in, entering or none", "", ""},
+	"StandbyMode":            {"summary.runtime.standbyMode", "", ""},
+	"PowerState":             {"summary.runtime.powerState", "", ""},
+	"LocalDatastores":        {"datastore, those not shared with other hosts", "datastores", ""},
+	"LocalDatastoreCapacity": {"datastore[].summary.capacity of the local datastores", "bytes", "higher"},
+	"LocalDatastoreFree":     {"datastore[].summary.freeSpace of the local datastores", "bytes", "higher"},
+	"ProvisionedVCPU":        {"vm[].config.hardware.numCPU", "vCPUs", "lower"},
+	"VcpuOvercommitRatio":    {"ProvisionedVCPU / NumCpuCores", "ratio", "lower"},
+	"BootDevice":             {"config.fileSystemVolume, config.deploymentInfo, the OSDATA disk in config.storageDevice.scsiLun or else QueryBootDevices: disk, sd, usb, stateless, stateless-cache or unknown", "", ""},
+	"VMotionEnabled":         {"config.virtualNicManagerInfo.netConfig[vmotion].selectedVnic, or config.vmotion with config.network.vnic", "", ""},
+	"FtSupported":            {"capability.ftSupported", "", ""},
+	"FtLoggingEnabled":       {"config.virtualNicManagerInfo.netConfig[faultToleranceLogging].selectedVnic", "", ""},
+	"DeadStoragePaths":       {"config.storageDevice.multipathInfo.lun[].path[].state", "paths", "lower"},
+	"MaxRunningVMs":          {"capability.maxRunningVMs", "VMs", "higher"},
+	"MaxSupportedVMs":        {"capability.maxSupportedVMs", "VMs", "higher"},
+	"MaxRegisteredVMs":       {"capability.maxRegisteredVMs", "VMs", "higher"},
+	"MaxSupportedVcpus":      {"capability.maxSupportedVcpus", "vCPUs", "higher"},
+	"MoRef":                  {"HostSystem managed object id, unique within a vcenter: VCenter and MoRef tell hosts of the same name apart", "", ""},
+	"FreeCpuDelta":           {"FreeCPU - FreeCPU of the host in the -delta output", "MHz", ""},
+	"ConnectionState":        {"summary.runtime.connectionState: connected, disconnected or notResponding, the capacity columns are 0 unless connected", "", ""},
+	"DrsEnabled":             {"parent.configurationEx.drsConfig.enabled, false for hosts outside a cluster", "", ""},
+	"DrsAutomationLevel":     {"parent.configurationEx.drsConfig.defaultVmBehavior: manual, partiallyAutomated or fullyAutomated, empty without DRS", "", ""},
+	"FreeMemoryDelta":        {"FreeMemory - FreeMemory of the host in the -delta output", "bytes", ""},
+	"EstimatedFreeVMs":       {"AverageVM that fit in FreeCPU, a vCPU taking one core's MHz, and in FreeMemory, only written with AverageVM", "vms", "higher"},
+	"Error":                  {"Lookups that failed for the host, its other columns are what was collected, only written with IncludePartialRows", "", ""},
+}
+
+// explain prints every output column with its source, unit and which way is better
+func explain(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tTYPE\tUNIT\tBETTER\tSOURCE")
+	t := reflect.TypeOf(hostStat{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() == reflect.Map {
+			continue
+		}
+		meta, ok := fieldMetas[f.Name]
+		if !ok {
+			meta.source = "?"
+		}
+		kind := f.Type.Kind()
+		if kind == reflect.Ptr {
+			kind = f.Type.Elem().Kind()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", f.Name, kind, dash(meta.unit), dash(meta.better), meta.source)
+	}
+	fmt.Fprintf(tw, "label.<key>\tstring\t-\t-\tLabels of the vcenter in the configuration\n")
+	fmt.Fprintf(tw, "tag.<category>\tstring\t-\t-\tvSphere tags of the host in TagCategories, joined with ;\n")
+	fmt.Fprintf(tw, "attr.<name>\tstring\t-\t-\tcustomValue of the host for CustomAttributes\n")
+	tw.Flush()
+	fmt.Fprintln(w, "\nSources are HostSystem properties. Sizes in bytes are written like 12.0GB in csv.")
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
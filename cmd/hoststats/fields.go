@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// fieldProperties maps output fields to the HostSystem property they are read from.
+// Fields not listed come from "summary", which is always retrieved.
+var fieldProperties = map[string]string{
+	"Cluster":     "parent",
+	"Datacenter":  "parent",
+	"Version":     "config",
+	"Build":       "config",
+	"FullVersion": "config",
+	"Vendor":      "hardware",
+	"Model":       "hardware",
+	"NtpServers":  "config",
+	"NtpRunning":  "config",
+
+	"DrsEnabled":         "parent",
+	"DrsAutomationLevel": "parent",
+
+	"MaintenanceState": "recentTask",
+
+	"LocalDatastores":        "datastore",
+	"LocalDatastoreCapacity": "datastore",
+	"LocalDatastoreFree":     "datastore",
+
+	"ProvisionedVCPU":     "vm",
+	"VcpuOvercommitRatio": "vm",
+
+	"BootDevice": "config",
+
+	"VMotionEnabled":   "config",
+	"FtSupported":      "capability",
+	"FtLoggingEnabled": "config",
+
+	"DeadStoragePaths": "config",
+
+	"MaxRunningVMs":     "capability",
+	"MaxSupportedVMs":   "capability",
+	"MaxRegisteredVMs":  "capability",
+	"MaxSupportedVcpus": "capability",
+}
+
+// optionalColumns are only written when turned on by the configuration setting of the same name
+var optionalColumns = map[string]func(Configuration) bool{
+	"MemorySizeBytes":  func(config Configuration) bool { return config.MemorySizeBytes },
+	"FreeCpuDelta":     func(config Configuration) bool { return config.delta != "" },
+	"FreeMemoryDelta":  func(config Configuration) bool { return config.delta != "" },
+	"EstimatedFreeVMs": func(config Configuration) bool { return config.AverageVM != nil },
+	"Error":            func(config Configuration) bool { return config.IncludePartialRows },
+}
+
+// selectFields resolves the configured Fields (case-insensitive) against the columns into column indexes.
+// No Fields keeps every column but the optional ones not turned on.
+func (config *Configuration) selectFields(columns []string) error {
+	config.columns = nil
+	index := make(map[string]int)
+	off := make(map[string]string)
+	for i, column := range columns {
+		if enabled, ok := optionalColumns[column]; ok && !enabled(*config) {
+			off[strings.ToLower(column)] = column
+			continue
+		}
+		index[strings.ToLower(column)] = i
+	}
+	if len(config.Fields) == 0 {
+		if len(off) == 0 {
+			return nil
+		}
+		config.columns = make([]int, 0, len(index))
+		for i, column := range columns {
+			if _, hidden := off[strings.ToLower(column)]; !hidden {
+				config.columns = append(config.columns, i)
+			}
+		}
+		return nil
+	}
+
+	for i, field := range config.Fields {
+		n, ok := index[strings.ToLower(field)]
+		if column, hidden := off[strings.ToLower(field)]; hidden {
+			return fmt.Errorf("field %q needs %s set in the configuration", field, column)
+		}
+		if !ok {
+			return fmt.Errorf("unknown field %q", field)
+		}
+		config.Fields[i] = columns[n]
+		config.columns = append(config.columns, n)
+	}
+
+	return nil
+}
+
+// pick returns the selected columns of a row
+func (config Configuration) pick(row []string) []string {
+	if config.columns == nil {
+		return row
+	}
+	picked := make([]string, len(config.columns))
+	for i, n := range config.columns {
+		picked[i] = row[n]
+	}
+	return picked
+}
+
+// usedFields are the selected fields and the ones alerts, SortBy and StateFile read, which are
+// collected even when they are not written
+func (config Configuration) usedFields() []string {
+	fields := append([]string(nil), config.Fields...)
+	for _, rule := range config.alerts {
+		fields = append(fields, rule.metric)
+		if rule.Cluster || len(rule.Clusters) > 0 {
+			fields = append(fields, "Cluster")
+		}
+	}
+	if config.sortMetric != "" {
+		fields = append(fields, config.sortMetric)
+	}
+	if config.StateFile != "" {
+		fields = append(fields, "Cluster", "Version", "Build")
+	}
+	return fields
+}
+
+// hostProperties returns the HostSystem properties needed for the used fields
+func (config Configuration) hostProperties() []string {
+	if config.countOnly {
+		return []string{"name"}
+	}
+	if len(config.Fields) == 0 {
+		properties := []string{"summary", "parent", "hardware", "config", "configManager", "recentTask", "datastore", "vm", "capability"}
+		if len(config.CustomAttributes) > 0 {
+			properties = append(properties, "customValue")
+		}
+		return properties
+	}
+
+	needed := map[string]bool{"summary": true}
+	for _, field := range config.usedFields() {
+		if property, ok := fieldProperties[field]; ok {
+			needed[property] = true
+		}
+		if field == "BootDevice" {
+			// the boot device is queried from the host's boot device system when the config doesn't name it
+			needed["configManager"] = true
+		}
+	}
+	if config.SwitchOutpath != "" {
+		needed["config"] = true
+	}
+	if config.CpuFeatureOutpath != "" {
+		needed["hardware"] = true
+	}
+	if config.ClusterOutpath != "" {
+		needed["parent"] = true
+	}
+	if config.HbaOutpath != "" {
+		needed["config"] = true
+	}
+	if len(config.CustomAttributes) > 0 {
+		needed["customValue"] = true
+	}
+
+	var properties []string
+	for property := range needed {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+	return properties
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+func TestHostProperties(t *testing.T) {
+	tests := []struct {
+		fields []string
+		want   []string
+	}{
+		{[]string{"Host", "FreeCPU"}, []string{"summary"}},
+		{[]string{"Host", "Cluster"}, []string{"parent", "summary"}},
+		{[]string{"Host", "DrsEnabled"}, []string{"parent", "summary"}},
+		{[]string{"Host", "DrsAutomationLevel"}, []string{"parent", "summary"}},
+		{[]string{"Host", "Version", "Model"}, []string{"config", "hardware", "summary"}},
+		{[]string{"Host", "BootDevice"}, []string{"config", "configManager", "summary"}},
+	}
+	for _, tt := range tests {
+		got := Configuration{Config: settings.Config{Fields: tt.fields}}.hostProperties()
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("properties of %v are %v, want %v", tt.fields, got, tt.want)
+		}
+	}
+}
+
+func TestUsedFieldsAreCollected(t *testing.T) {
+	config := Configuration{
+		Config: settings.Config{
+			Fields:    []string{"Host"},
+			Alerts:    []settings.Alert{{Rule: "DeadStoragePaths > 0"}, {Rule: "Hosts < 2", Cluster: true}},
+			SortBy:    "ProvisionedVCPU",
+			StateFile: "state.json",
+		},
+	}
+	if err := config.prepareAlerts(); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.prepareSort(); err != nil {
+		t.Fatal(err)
+	}
+	got := config.hostProperties()
+	want := []string{"config", "parent", "summary", "vm"}
+	if !slices.Equal(got, want) {
+		t.Errorf("properties are %v, want %v", got, want)
+	}
+}
+
+// an alert on a field that is not written sees the same values as when it is
+func TestAlertOnUnselectedField(t *testing.T) {
+	vcenter := newSimulator(t, nil)
+	path := filepath.Join(t.TempDir(), "hosts.csv")
+	runCollection(t, Configuration{
+		Config: settings.Config{
+			Outpath: path,
+			Fields:  []string{"Host", "ProvisionedVCPU"},
+		},
+		VCenters: []*VCenter{vcenter},
+	})
+	running := 0
+	for _, row := range readRows(t, path) {
+		if row["ProvisionedVCPU"] != "0" {
+			running++
+		}
+	}
+
+	summary := runCollection(t, Configuration{
+		Config: settings.Config{
+			Outpath: path,
+			Fields:  []string{"Host", "FreeCPU"},
+			Alerts:  []settings.Alert{{Rule: "ProvisionedVCPU > 0"}},
+		},
+		VCenters: []*VCenter{vcenter},
+	})
+	if running == 0 || len(summary.Alerts) != running || summary.ExitCode != exitAlerts {
+		t.Errorf("%d alerts with exit code %d, want %d hosts running vms and exit code %d", len(summary.Alerts), summary.ExitCode, running, exitAlerts)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// hbaStat is a host bus adapter of a host, Type is iscsi, fc, fcoe, sas, scsi, block or other
+type hbaStat struct {
+	Host      string
+	Device    string
+	Type      string
+	Model     string
+	Driver    string
+	Status    string
+	IScsiName string
+	PortWWN   string
+}
+
+func (r hbaStat) Headers() []string {
+	var res []string
+	t := reflect.TypeOf(r)
+	for i := 0; i < t.NumField(); i++ {
+		res = append(res, t.Field(i).Name)
+	}
+	return res
+}
+
+func (r hbaStat) Slice() []string {
+	return []string{
+		r.Host,
+		r.Device,
+		r.Type,
+		r.Model,
+		r.Driver,
+		r.Status,
+		r.IScsiName,
+		r.PortWWN,
+	}
+}
+
+// hostHBAs lists the host bus adapters of a host, none when the storage config is missing
+func hostHBAs(host string, hs mo.HostSystem) []hbaStat {
+	if hs.Config == nil || hs.Config.StorageDevice == nil {
+		return nil
+	}
+
+	var hbas []hbaStat
+	for _, adapter := range hs.Config.StorageDevice.HostBusAdapter {
+		a := adapter.GetHostHostBusAdapter()
+		hba := hbaStat{
+			Host:   host,
+			Device: a.Device,
+			Type:   "other",
+			Model:  a.Model,
+			Driver: a.Driver,
+			Status: a.Status,
+		}
+		switch a := adapter.(type) {
+		case *types.HostInternetScsiHba:
+			hba.Type = "iscsi"
+			hba.IScsiName = a.IScsiName
+		case *types.HostFibreChannelHba:
+			hba.Type = "fc"
+			hba.PortWWN = wwn(a.PortWorldWideName)
+		case *types.HostFibreChannelOverEthernetHba:
+			hba.Type = "fcoe"
+			hba.PortWWN = wwn(a.PortWorldWideName)
+		case *types.HostSerialAttachedHba:
+			hba.Type = "sas"
+		case *types.HostParallelScsiHba:
+			hba.Type = "scsi"
+		case *types.HostBlockHba:
+			hba.Type = "block"
+		}
+		hbas = append(hbas, hba)
+	}
+
+	return hbas
+}
+
+// wwn formats a world wide name the way vSphere shows it, 20:00:00:25:b5:00:00:0f
+func wwn(n int64) string {
+	var parts []string
+	for shift := 56; shift >= 0; shift -= 8 {
+		parts = append(parts, fmt.Sprintf("%02x", byte(uint64(n)>>uint(shift))))
+	}
+	return strings.Join(parts, ":")
+}
+
+// deadPaths counts the storage paths of the host that are dead, lost LUN connectivity shows here first
+func deadPaths(hs mo.HostSystem) int {
+	if hs.Config == nil || hs.Config.StorageDevice == nil || hs.Config.StorageDevice.MultipathInfo == nil {
+		return 0
+	}
+	dead := 0
+	for _, lun := range hs.Config.StorageDevice.MultipathInfo.Lun {
+		for _, path := range lun.Path {
+			if path.State == string(types.MultipathStateDead) || path.PathState == string(types.MultipathStateDead) {
+				dead++
+			}
+		}
+	}
+	return dead
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/BilboTheGreedy/hostStats/collector"
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+// estimatedFreeVMs is how many average vms fit in the free CPU and memory of the host, whichever runs
+// out first. A dimension the average vm leaves at 0 doesn't limit it, a host without capacity fits none.
+// It is nil without AverageVM.
+func (config Configuration) estimatedFreeVMs(s hostStat) *int {
+	size := config.AverageVM
+	if size == nil {
+		return nil
+	}
+	fits := 0
+	if s.NumCpuCores > 0 && s.FreeCPU > 0 && s.FreeMemory > 0 {
+		fits = vmsFitting(size, s)
+	}
+	return &fits
+}
+
+// vmsFitting is how many vms of size fit in the free capacity of s
+func vmsFitting(size *settings.VMSize, s hostStat) int {
+	fits := -1
+	if size.Vcpus > 0 {
+		perVM := int64(size.Vcpus) * (s.TotalCPU / int64(s.NumCpuCores))
+		if perVM > 0 {
+			fits = int(s.FreeCPU / perVM)
+		}
+	}
+	if size.MemoryMB > 0 {
+		byMemory := int(s.FreeMemory / collector.MBToBytes(size.MemoryMB))
+		if fits < 0 || byMemory < fits {
+			fits = byMemory
+		}
+	}
+	if fits < 0 {
+		return 0
+	}
+	return fits
+}
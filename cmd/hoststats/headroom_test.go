@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+func TestEstimatedFreeVMs(t *testing.T) {
+	// 16 cores of 2000MHz and 256GB
+	host := hostStat{NumCpuCores: 16, TotalCPU: 32000, FreeCPU: 16000, FreeMemory: 128 * 1024 * 1024 * 1024}
+	full := hostStat{NumCpuCores: 16, TotalCPU: 32000, FreeCPU: 0, FreeMemory: 0}
+	disconnected := hostStat{NumCpuCores: 16}
+
+	tests := []struct {
+		name string
+		size settings.VMSize
+		host hostStat
+		want int
+	}{
+		{"cpu bound", settings.VMSize{Vcpus: 4, MemoryMB: 4096}, host, 2},
+		{"memory bound", settings.VMSize{Vcpus: 1, MemoryMB: 32768}, host, 4},
+		{"cpu only", settings.VMSize{Vcpus: 2}, host, 4},
+		{"memory only", settings.VMSize{MemoryMB: 16384}, host, 8},
+		{"full host", settings.VMSize{Vcpus: 1, MemoryMB: 1024}, full, 0},
+		{"disconnected host", settings.VMSize{Vcpus: 1, MemoryMB: 1024}, disconnected, 0},
+	}
+	for _, tt := range tests {
+		got := Configuration{Config: settings.Config{AverageVM: &tt.size}}.estimatedFreeVMs(tt.host)
+		if got == nil || *got != tt.want {
+			t.Errorf("%s: %v vms fit, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	if got := (Configuration{}).estimatedFreeVMs(host); got != nil {
+		t.Errorf("%d vms fit without AverageVM, want none", *got)
+	}
+}
+
+// a host that fits no vms still has the field in json, only a run without AverageVM leaves it out
+func TestEstimatedFreeVMsJSON(t *testing.T) {
+	with, err := json.Marshal(hostStat{EstimatedFreeVMs: (&Configuration{Config: settings.Config{AverageVM: &settings.VMSize{Vcpus: 1}}}).estimatedFreeVMs(hostStat{})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(with), `"EstimatedFreeVMs":0`) {
+		t.Errorf("host without room is %s, want EstimatedFreeVMs 0", with)
+	}
+	without, err := json.Marshal(hostStat{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(without), "EstimatedFreeVMs") {
+		t.Errorf("host without AverageVM is %s, want no EstimatedFreeVMs", without)
+	}
+}
+
+// EstimatedFreeVMs is a metric of alerts and sorting like the other numeric columns, for hosts and clusters
+func TestEstimatedFreeVMsMetric(t *testing.T) {
+	metric, ok := metricName("estimated free vms")
+	if !ok || metric != "EstimatedFreeVMs" {
+		t.Fatalf("metric %q, %v", metric, ok)
+	}
+	two, three := 2, 3
+	hosts := []hostStat{{EstimatedFreeVMs: &two}, {EstimatedFreeVMs: &three}}
+	if got := metricValue(hosts[1], metric, 1); got != 3 {
+		t.Errorf("host value %v, want 3", got)
+	}
+	if got := metricValue(clusterTotal(hosts), metric, len(hosts)); got != 5 {
+		t.Errorf("cluster value %v, want 5", got)
+	}
+	if got := metricValue(hostStat{}, metric, 1); got != 0 {
+		t.Errorf("value without AverageVM %v, want 0", got)
+	}
+	if clusterTotal([]hostStat{{}, {}}).EstimatedFreeVMs != nil {
+		t.Error("cluster without AverageVM has EstimatedFreeVMs")
+	}
+}
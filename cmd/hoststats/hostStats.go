@@ -0,0 +1,1192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BilboTheGreedy/hostStats/collector"
+	settings "github.com/BilboTheGreedy/hostStats/config"
+	writers "github.com/BilboTheGreedy/hostStats/output"
+	"github.com/robfig/cron/v3"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	gomail "gopkg.in/gomail.v2"
+)
+
+const (
+	// name of the service
+	name        = "host Stats"
+	description = "collect host stats from multiple vcenter instances"
+
+	// exit code when the run was stopped by SIGINT/SIGTERM
+	exitShutdown = 3
+	// exit code when fewer hosts than MinExpectedHosts were collected
+	exitTooFewHosts = 4
+
+	// Cluster of the hosts that are not in a cluster
+	standaloneCluster = collector.StandaloneCluster
+)
+
+type hostStat struct {
+	Cluster                string
+	Host                   string
+	Version                string
+	Build                  string
+	Vendor                 string
+	Model                  string
+	NumCpuPkgs             int16
+	NumCpuCores            int16
+	NumCpuThreads          int16
+	CpuModel               string
+	TotalCPU               int64
+	FreeCPU                int64
+	OverallMemoryUsage     int64 `csv:"size"`
+	MemorySize             int64 `csv:"size"`
+	MemorySizeBytes        int64 `json:",omitempty"`
+	FreeMemory             int64 `csv:"size"`
+	NtpServers             string
+	NtpRunning             bool
+	VCenter                string
+	Site                   string
+	MaintenanceMode        bool
+	MaintenanceState       string
+	StandbyMode            string
+	PowerState             string
+	LocalDatastores        int
+	LocalDatastoreCapacity int64 `csv:"size"`
+	LocalDatastoreFree     int64 `csv:"size"`
+	ProvisionedVCPU        int
+	VcpuOvercommitRatio    float64
+	BootDevice             string
+	VMotionEnabled         bool
+	FtSupported            bool
+	FtLoggingEnabled       bool
+	DeadStoragePaths       int
+	MaxRunningVMs          int32
+	MaxSupportedVMs        int32
+	MaxRegisteredVMs       int32
+	MaxSupportedVcpus      int32
+	FreeCpuDelta           *int64 `json:",omitempty"`
+	FreeMemoryDelta        *int64 `json:",omitempty" csv:"size"`
+	MoRef                  string
+	ConnectionState        string
+	DrsEnabled             bool
+	DrsAutomationLevel     string
+	EstimatedFreeVMs       *int   `json:",omitempty"`
+	Error                  string `json:",omitempty"`
+	FullVersion            string
+	CpuUsagePercent        float64
+	MemoryUsagePercent     float64
+	Datacenter             string
+	Labels                 map[string]string `json:",omitempty"`
+	Tags                   map[string]string `json:",omitempty"`
+}
+
+// hostColumn is a hostStat field written as a column. The column is named after the field and formatted by its
+// kind, fields tagged csv:"size" hold bytes and are written like 12.0GB. Pointers are optional and empty when nil.
+type hostColumn struct {
+	name   string
+	index  int
+	format func(reflect.Value) string
+}
+
+// hostColumns is the single list Headers and Slice are built from, in field order. Labels and tags are emitted
+// as their own columns after these.
+var hostColumns = func() []hostColumn {
+	var columns []hostColumn
+	t := reflect.TypeOf(hostStat{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() == reflect.Map {
+			continue
+		}
+		columns = append(columns, hostColumn{name: f.Name, index: i, format: columnFormat(f)})
+	}
+	return columns
+}()
+
+func columnFormat(f reflect.StructField) func(reflect.Value) string {
+	kind := f.Type.Kind()
+	if kind == reflect.Ptr {
+		kind = f.Type.Elem().Kind()
+	}
+	var format func(reflect.Value) string
+	switch {
+	case f.Tag.Get("csv") == "size":
+		format = func(v reflect.Value) string { return signedSize(v.Int()) }
+	case kind == reflect.String:
+		format = func(v reflect.Value) string { return v.String() }
+	case kind == reflect.Bool:
+		format = func(v reflect.Value) string { return strconv.FormatBool(v.Bool()) }
+	case kind == reflect.Float64:
+		format = func(v reflect.Value) string { return strconv.FormatFloat(v.Float(), 'f', 2, 64) }
+	case kind >= reflect.Int && kind <= reflect.Int64:
+		format = func(v reflect.Value) string { return strconv.FormatInt(v.Int(), 10) }
+	default:
+		panic("hostStat." + f.Name + ": no column format for " + kind.String())
+	}
+	if f.Type.Kind() != reflect.Ptr {
+		return format
+	}
+	return func(v reflect.Value) string {
+		if v.IsNil() {
+			return ""
+		}
+		return format(v.Elem())
+	}
+}
+
+// Headers returns the column names, labels and tags are emitted as their own columns after these
+func (r hostStat) Headers() []string {
+	res := make([]string, len(hostColumns))
+	for i, column := range hostColumns {
+		res[i] = column.name
+	}
+	return res
+}
+
+// rawHost is a host summary exactly as vcenter returned it, for -dump-raw
+type rawHost struct {
+	VCenter string
+	Host    string
+	Summary types.HostListSummary
+}
+
+// Slice returns the values of the columns of Headers
+func (r hostStat) Slice() []string {
+	v := reflect.ValueOf(r)
+	values := make([]string, len(hostColumns))
+	for i, column := range hostColumns {
+		values[i] = column.format(v.Field(column.index))
+	}
+	return values
+}
+
+// Configuration is used to store config data, the configuration file and what the run derives from it
+type Configuration struct {
+	settings.Config
+	// the vcenters of the file with their run state, the file's are moved here when it is read
+	VCenters []*VCenter
+
+	siteRegex      *regexp.Regexp
+	logout         bool
+	labelKeys      []string
+	columns        []int
+	headers        []string
+	outputs        []*output
+	dumpRaw        string
+	countOnly      bool
+	validateSchema bool
+	noSort         bool
+	schedule       cron.Schedule
+	location       *time.Location
+	sortMetric     string
+	alerts         []alertRule
+
+	// connections kept between daemon cycles, nil for a single run
+	pool *clientPool
+	// sessions open at once per username during the current run
+	sessions *sessionSlots
+	// rows written per output during the current run
+	written *writtenRows
+
+	// -diff: compare the main output with a previous one, "auto" finds the newest earlier output
+	diff         string
+	diffFormat   string
+	diffVolatile bool
+	diffBase     string
+	// -delta: the output FreeCpuDelta and FreeMemoryDelta are computed against
+	delta     string
+	deltaBase *hostTable
+}
+
+// VCenter for VMware vCenter connections
+type VCenter struct {
+	settings.VCenter
+	client        *govmomi.Client
+	loginURL      *url.URL
+	sessionFile   string
+	keepSession   bool
+	logoutTimeout time.Duration
+	hostResults
+	err         error
+	firstErr    error
+	logoutErr   error
+	elapsed     time.Duration
+	connectTime time.Duration
+	collectTime time.Duration
+	calls       *callCounter
+	apiCalls    int64
+	retries     int
+	progress    *progress
+	Worker      int
+}
+
+func main() {
+
+	cfgFile := flag.String("config", "config.json", "path of the configuration file")
+	pretty := flag.Bool("pretty", false, "indent JSON output for readability")
+	showProgress := flag.Bool("progress", true, "draw the progress of every vcenter on stderr when run in a terminal, false logs it every 30 seconds instead")
+	dumpRaw := flag.String("dump-raw", "", "debug: write the raw host summaries returned by vcenter as JSON to this file")
+	countOnly := flag.Bool("count", false, "only print the number of hosts per vcenter, no output file is written")
+	logout := flag.Bool("logout", false, "log out of cached sessions at the end of the run instead of keeping them")
+	listOnly := flag.Bool("list-vcenters", false, "list the configured vcenters and exit without connecting")
+	explainOnly := flag.Bool("explain", false, "describe every output column, where it comes from and its unit, and exit")
+	tui := flag.Bool("tui", false, "browse the collected hosts in a terminal UI once the run is done")
+	tuiFile := flag.String("tui-file", "", "browse the hosts of this json output in a terminal UI instead of collecting")
+	merge := flag.String("merge", "", "merge the csv outputs given after the flags into this file instead of collecting, - for stdout")
+	mergeComma := flag.String("merge-comma", ",", "separator of the csv outputs given to -merge and of the merged file")
+	daemon := flag.Bool("daemon", false, "keep running and collect again every Interval from the configuration")
+	interval := flag.Duration("interval", 0, "collect every interval, like -daemon, writing timestamped output files each cycle")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "log format on stderr: text or json")
+	force := flag.Bool("force", false, "overwrite output files that already exist, like Overwrite in the configuration")
+	validate := flag.Bool("validate-schema", false, "check every json output against the embedded schema once written, a mismatch fails the run")
+	waitLock := flag.Duration("wait-lock", 0, "wait this long for another run holding the lock file to finish instead of exiting")
+	diff := flag.String("diff", "", "write a change report against this previous output, or auto for the newest earlier output")
+	diffFormat := flag.String("diff-format", "markdown", "format of the change report: csv, json or markdown")
+	diffVolatile := flag.Bool("diff-volatile", false, "include volatile fields like FreeCPU and FreeMemory in the change report")
+	noSort := flag.Bool("no-sort", false, "write the hosts in the order they were collected instead of sorted by vcenter, datacenter, cluster and host")
+	delta := flag.String("delta", "", "add FreeCpuDelta and FreeMemoryDelta columns against this previous output, or auto for the newest earlier output")
+	cpuProfile := flag.String("cpuprofile", "", "write a pprof cpu profile of the collection to this file")
+	memProfile := flag.String("memprofile", "", "write a pprof heap profile to this file when the collection ends")
+	debugListen := flag.String("debug-listen", "", "daemon: serve pprof and the worker state on this address, localhost unless a host is given")
+	service := flag.String("service", "", "windows: install, uninstall, start or stop the daemon as a service using this config")
+	var only stringList
+	flag.Var(&only, "vcenter", "only collect from vcenters whose hostname or name matches this glob, can be repeated")
+	flag.Parse()
+
+	eventLogErr := error(nil)
+	if runningAsService() {
+		eventLogErr = logToEventLog()
+	}
+	if err := setupLogging(os.Stderr, *logLevel, *logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if eventLogErr != nil {
+		slog.Warn("could not open the event log", "error", eventLogErr)
+	}
+	if *service != "" {
+		os.Exit(controlService(*service, *cfgFile))
+	}
+	if *explainOnly {
+		explain(os.Stdout)
+		return
+	}
+	if *tuiFile != "" {
+		stats, err := readStatsFile(*tuiFile)
+		if err != nil {
+			slog.Error("could not read hosts", "path", *tuiFile, "error", err)
+			os.Exit(1)
+		}
+		if err := browse(stats); err != nil {
+			slog.Error("terminal UI failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *merge != "" {
+		if err := mergeOutputs(*merge, flag.Args(), *mergeComma, *force); err != nil {
+			slog.Error("could not merge outputs", "phase", "merge", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	opts := options{pretty: *pretty, logout: *logout, only: only, dumpRaw: *dumpRaw, countOnly: *countOnly, daemon: *daemon || *interval > 0, interval: settings.Duration(*interval), force: *force, validate: *validate,
+		diff: *diff, diffFormat: *diffFormat, diffVolatile: *diffVolatile, delta: *delta, noSort: *noSort}
+
+	// read the configuration
+	config, err := readConfig(*cfgFile)
+	if err != nil {
+		slog.Error("could not read configuration file", "path", *cfgFile, "error", err)
+		os.Exit(1)
+	}
+	if err := config.prepare(opts); err != nil {
+		slog.Error("invalid configuration file", "path", *cfgFile, "error", err)
+		os.Exit(1)
+	}
+	if config.LogFile != "" {
+		logFile, err := openRotatingFile(config.LogFile, config.LogMaxSizeMB, config.LogMaxBackups, config.LogMaxAgeDays)
+		if err != nil {
+			slog.Error("could not open log file", "path", config.LogFile, "error", err)
+			os.Exit(1)
+		}
+		var w io.Writer = io.MultiWriter(os.Stderr, logFile)
+		if config.LogFileOnly {
+			w = logFile
+		}
+		if err := setupLogging(w, *logLevel, *logFormat); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *listOnly {
+		listVCenters(os.Stdout, config.VCenters)
+		return
+	}
+
+	var lock *runLock
+	if path := config.lockPath(time.Now()); path != "" && !config.countOnly {
+		lock, err = acquireLock(path, *waitLock)
+		if err != nil {
+			slog.Error("another run is in progress", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *debugListen != "" {
+		if opts.daemon {
+			startDebugServer(*debugListen)
+		} else {
+			slog.Warn("-debug-listen is only used in daemon mode")
+		}
+	}
+	if opts.daemon && *tui {
+		slog.Warn("-tui is only used for a single run")
+	}
+	profiles, err = startProfiles(*cpuProfile, *memProfile)
+	if err != nil {
+		slog.Error("could not profile", "error", err)
+		lock.release()
+		os.Exit(1)
+	}
+	if opts.daemon {
+		reloader := newConfigReloader(*cfgFile, opts, config)
+		if runningAsService() {
+			code := runService(reloader)
+			profiles.stop()
+			lock.release()
+			os.Exit(code)
+		}
+		ctx, quit := stopOnSignals()
+		code := runDaemon(ctx, reloader, quit)
+		profiles.stop()
+		lock.release()
+		os.Exit(code)
+	}
+
+	// stop collecting on SIGINT/SIGTERM, what was collected so far is only written with KeepPartialOutput
+	ctx := cancelOnSignals()
+	code := collect(ctx, config, *showProgress).ExitCode
+	profiles.stop()
+	lock.release()
+	if *tui {
+		var stats []hostStat
+		for _, vcenter := range config.VCenters {
+			stats = append(stats, vcenter.stats...)
+		}
+		if err := browse(stats); err != nil {
+			slog.Error("terminal UI failed", "error", err)
+		}
+	}
+	os.Exit(code)
+}
+
+// collect runs one full collection from all vcenters and writes the outputs,
+// it returns the summary of the run with its exit code
+func collect(ctx context.Context, config Configuration, showProgress bool) runSummary {
+	start := time.Now()
+	config.expandOutpaths(start)
+	config.written = &writtenRows{}
+	config.sessions = newSessionSlots(config.MaxSessionsPerUser)
+	if err := config.checkOverwrite(); err != nil {
+		slog.Error("refusing to overwrite output, use -force or set Overwrite", "error", err)
+		return runSummary{Start: start, ExitCode: 1}
+	}
+	if err := config.checkOutputDirs(); err != nil {
+		slog.Error("cannot write output", "error", err)
+		return runSummary{Start: start, ExitCode: 1}
+	}
+
+	previous, previousPath := config.readPrevious(config.diff, "diff")
+	config.deltaBase, _ = config.readPrevious(config.delta, "delta")
+
+	sinks, collecting, cancel := config.runDeadline(ctx, start)
+	defer cancel()
+	code := collectAndWrite(collecting, sinks, config, showProgress)
+	if previous != nil && code != 1 {
+		config.writeDiff(previous, previousPath)
+	}
+	var alerts []alertStat
+	if code != 1 && !config.countOnly {
+		alerts = config.checkAlerts(sinks)
+		if len(alerts) > 0 && code == 0 {
+			code = exitAlerts
+		}
+	}
+
+	summary := config.summarize(start)
+	summary.Alerts = alerts
+	summary.ExitCode = config.exitCode(code, summary)
+	summary.print(os.Stderr)
+	if config.WriteSummary {
+		if err := jsonExport(summary, config.summaryPath(), true); err != nil {
+			slog.Error("could not write summary", "phase", "write", "path", config.summaryPath(), "error", err)
+		} else {
+			slog.Info("summary saved", "phase", "write", "path", config.summaryPath())
+		}
+	}
+	return summary
+}
+
+// collectAndWrite collects from the vcenters until ctx is done and writes the outputs,
+// network outputs until sinks is done. It returns the exit code for the run before the
+// vcenter failures are taken into account.
+func collectAndWrite(ctx, sinks context.Context, config Configuration, showProgress bool) int {
+	//spew.Dump(config)
+
+	if err := resolveSecrets(ctx, config.VCenters); err != nil {
+		slog.Error("could not resolve secrets", "phase", "secrets", "error", err)
+		return 1
+	}
+
+	// make the channels, get the time, launch the goroutines
+	vcenterCount := len(config.VCenters)
+	slog.Info("starting collection", "vcenters", vcenterCount)
+	vcenters := make(chan *VCenter, vcenterCount)
+	results := make(chan workerResult, vcenterCount)
+	progress := newProgress(showProgress, vcenterCount)
+
+	slog.Debug("submitting jobs to workers")
+	for i, vcenter := range config.VCenters {
+		vcenter.Worker = i
+		go worker(ctx, i, config, vcenters, results, progress)
+	}
+
+	for i, vcenter := range config.VCenters {
+		if i > 0 {
+			config.connectPause(ctx)
+		}
+		vcenters <- vcenter
+
+	}
+	close(vcenters)
+
+	for i := 0; i < vcenterCount; i++ {
+		(<-results).record()
+		markActivity()
+	}
+	progress.finish()
+	if config.RetryFailedAtEnd {
+		config.retryFailed(ctx)
+	}
+	if config.countOnly {
+		printCounts(os.Stdout, config.VCenters)
+		if ctx.Err() != nil {
+			return exitShutdown
+		}
+		total := 0
+		for _, vcenter := range config.VCenters {
+			total += vcenter.hostCount
+		}
+		if config.tooFewHosts(total) {
+			return exitTooFewHosts
+		}
+		return 0
+	}
+
+	if code, failed := config.failedRun(ctx); failed && !config.KeepPartialOutput {
+		slog.Warn("run did not complete, the previous outputs are kept, set KeepPartialOutput to write what was collected", "phase", "write")
+		return code
+	}
+
+	//take the results and export them to the output file
+	slog.Debug("merging results", "phase", "write")
+
+	var stats []hostStat
+	var hostRows [][]string
+	for _, vcenter := range config.VCenters {
+		vcenter.logger().Info("collected hosts", "hosts", len(vcenter.Data))
+		hostRows = append(hostRows, vcenter.Data...)
+		stats = append(stats, vcenter.stats...)
+	}
+	if config.DeduplicateHosts {
+		stats, hostRows = dedupeHosts(stats, hostRows)
+	}
+	warnDuplicateHosts(stats)
+	stats, hostRows = config.sortHosts(stats, hostRows)
+	var report []errorRecord
+	if config.ErrorReport {
+		report = config.errorReport()
+		for _, o := range config.outputs {
+			if o.Format == "csv" {
+				config.writeErrors(errorsPath(o.Path), report)
+			}
+		}
+	}
+	if len(stats) == 0 {
+		slog.Warn("no hosts were collected")
+		if config.SkipEmptyOutput {
+			// the outputs of an earlier run are left as they are
+			slog.Info("skipping empty output, the previous output is kept", "path", config.Outpath)
+			if config.tooFewHosts(0) {
+				return exitTooFewHosts
+			}
+			return 0
+		}
+		stats = []hostStat{}
+	}
+	var state *inventoryState
+	var changes []hostChange
+	if config.StateFile != "" {
+		var err error
+		if state, err = loadState(config.StateFile); err != nil {
+			slog.Error("could not read state file", "phase", "state", "path", config.StateFile, "error", err)
+			return 1
+		}
+		changes = state.update(config.VCenters)
+		if len(changes) == 0 && !state.missing {
+			slog.Info("inventory unchanged, skipping outputs", "phase", "state", "path", config.StateFile)
+			switch {
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				return exitPartial
+			case ctx.Err() != nil:
+				return exitShutdown
+			case config.tooFewHosts(len(stats)):
+				return exitTooFewHosts
+			}
+			return 0
+		}
+		if !state.missing {
+			slog.Info("inventory changed", "phase", "state", "changes", len(changes))
+		}
+	}
+	invalid := false
+	for _, o := range config.outputs {
+		if o.Format == "kafka" {
+			if err := o.publish(sinks, hostRows, stats); err != nil {
+				slog.Error("could not publish results", "phase", "write", "topic", o.Topic, "error", err)
+			} else {
+				slog.Info("results published", "phase", "write", "topic", o.Topic, "hosts", len(stats))
+				config.written.add(o.name(), len(stats))
+			}
+			continue
+		}
+		var err error
+		if config.ErrorReport && o.Format == "json" {
+			err = o.writeReport(hostRows, stats, report, config.PrettyJSON)
+		} else {
+			err = o.write(hostRows, stats)
+		}
+		if err != nil {
+			slog.Error("could not write results", "phase", "write", "path", o.Path, "error", err)
+			continue
+		}
+		if config.validateSchema && o.Format == "json" {
+			if err := validateOutput(o.Path); err != nil {
+				slog.Error("output does not match the schema", "phase", "validate", "path", o.Path, "error", err)
+				invalid = true
+			}
+		}
+		slog.Info("results saved", "phase", "write", "path", o.Path)
+		config.written.add(o.name(), len(stats))
+	}
+
+	if config.dumpRaw != "" {
+		raw := []rawHost{}
+		for _, vcenter := range config.VCenters {
+			raw = append(raw, vcenter.raw...)
+		}
+		if err := jsonExport(raw, config.dumpRaw, true); err != nil {
+			slog.Error("could not write raw summaries", "phase", "write", "path", config.dumpRaw, "error", err)
+		} else {
+			slog.Info("raw summaries saved", "phase", "write", "path", config.dumpRaw)
+		}
+	}
+
+	if config.SwitchOutpath != "" {
+		switches := []switchStat{}
+		var rows [][]string
+		for _, vcenter := range config.VCenters {
+			switches = append(switches, vcenter.switches...)
+		}
+		config.sortSwitches(switches)
+		for _, sw := range switches {
+			rows = append(rows, sw.Slice())
+		}
+		if err := config.exportTable(config.SwitchOutpath, switchStat{}.Headers(), rows, switches); err != nil {
+			slog.Error("could not write switches", "phase", "write", "path", config.SwitchOutpath, "error", err)
+		} else {
+			slog.Info("switches saved", "phase", "write", "path", config.SwitchOutpath)
+			config.written.add(config.SwitchOutpath, len(rows))
+		}
+	}
+	if config.CpuFeatureOutpath != "" {
+		features := []cpuFeatureStat{}
+		var rows [][]string
+		for _, vcenter := range config.VCenters {
+			features = append(features, vcenter.cpuFeatures...)
+		}
+		config.sortCPUFeatures(features)
+		for _, f := range features {
+			rows = append(rows, f.Slice())
+		}
+		if err := config.exportTable(config.CpuFeatureOutpath, cpuFeatureStat{}.Headers(), rows, features); err != nil {
+			slog.Error("could not write cpu features", "phase", "write", "path", config.CpuFeatureOutpath, "error", err)
+		} else {
+			slog.Info("cpu features saved", "phase", "write", "path", config.CpuFeatureOutpath)
+			config.written.add(config.CpuFeatureOutpath, len(rows))
+		}
+	}
+	if config.ClusterOutpath != "" {
+		clusters := []clusterStat{}
+		var rows [][]string
+		for _, vcenter := range config.VCenters {
+			clusters = append(clusters, vcenter.clusters...)
+		}
+		config.sortClusters(clusters)
+		for _, c := range clusters {
+			rows = append(rows, c.Slice())
+		}
+		if err := config.exportTable(config.ClusterOutpath, clusterStat{}.Headers(), rows, clusters); err != nil {
+			slog.Error("could not write clusters", "phase", "write", "path", config.ClusterOutpath, "error", err)
+		} else {
+			slog.Info("clusters saved", "phase", "write", "path", config.ClusterOutpath)
+			config.written.add(config.ClusterOutpath, len(rows))
+		}
+	}
+	if config.HbaOutpath != "" {
+		hbas := []hbaStat{}
+		var rows [][]string
+		for _, vcenter := range config.VCenters {
+			hbas = append(hbas, vcenter.hbas...)
+		}
+		config.sortHBAs(hbas)
+		for _, h := range hbas {
+			rows = append(rows, h.Slice())
+		}
+		if err := config.exportTable(config.HbaOutpath, hbaStat{}.Headers(), rows, hbas); err != nil {
+			slog.Error("could not write host bus adapters", "phase", "write", "path", config.HbaOutpath, "error", err)
+		} else {
+			slog.Info("host bus adapters saved", "phase", "write", "path", config.HbaOutpath)
+			config.written.add(config.HbaOutpath, len(rows))
+		}
+	}
+	if state != nil {
+		if state.missing {
+			slog.Info("state file created, nothing to compare with yet", "phase", "state", "path", config.StateFile, "hosts", len(state.Hosts))
+		} else {
+			config.notifyChanges(sinks, changes)
+		}
+		if err := state.save(config.StateFile); err != nil {
+			slog.Error("could not save state file", "phase", "state", "path", config.StateFile, "error", err)
+		}
+	}
+	if invalid {
+		return 1
+	}
+	// a run cut short only gets here with KeepPartialOutput
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		slog.Warn("run timed out, partial results saved as KeepPartialOutput is set", "timeout", time.Duration(config.RunTimeout))
+		return exitPartial
+	}
+	if ctx.Err() != nil {
+		slog.Warn("shutdown requested, partial results saved as KeepPartialOutput is set")
+		return exitShutdown
+	}
+	if config.tooFewHosts(len(stats)) {
+		return exitTooFewHosts
+	}
+	if config.MailResult {
+		slog.Info("mailing results", "phase", "mail", "path", config.Outpath)
+		if err := config.Mailit(sinks); err != nil {
+			slog.Error("could not mail results", "phase", "mail", "error", err)
+			config.written.mailFailed(err)
+		}
+	}
+	return 0
+}
+
+// failedRun reports whether the run was cut short or every vcenter failed, with its exit code
+func (config Configuration) failedRun(ctx context.Context) (int, bool) {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return exitPartial, true
+	case ctx.Err() != nil:
+		return exitShutdown, true
+	}
+	for _, vcenter := range config.VCenters {
+		if vcenter.err == nil {
+			return 0, false
+		}
+	}
+	return 1, len(config.VCenters) > 0
+}
+
+// tooFewHosts reports, and logs, when the total is below MinExpectedHosts
+func (config Configuration) tooFewHosts(total int) bool {
+	if total >= config.MinExpectedHosts {
+		return false
+	}
+	slog.Error("too few hosts collected", "hosts", total, "expected", config.MinExpectedHosts)
+	return true
+}
+
+// worker collects the vcenters it receives and sends a result for every one of them, failed or not
+func worker(ctx context.Context, id int, config Configuration, vcenters <-chan *VCenter, results chan<- workerResult, progress *progress) {
+	for vcenter := range vcenters {
+		vcenter.progress = progress
+		if ctx.Err() != nil {
+			slog.Info("shutting down, skipping vcenter", "worker", id, "vcenter", vcenter.Hostname)
+			vcenter.report("failed", 0, 0)
+			results <- workerResult{vcenter: vcenter, err: classify("connect", ctx.Err())}
+			continue
+		}
+
+		slog.Debug("received vcenter job", "worker", id, "vcenter", vcenter.Hostname)
+		results <- config.collectVCenter(ctx, id, vcenter)
+	}
+
+}
+
+// collectVCenter connects to the vcenter and collects it. Once connected the release of the vcenter is
+// deferred, so its session is logged out or handed back to the pool whichever way the collection ends.
+func (config Configuration) collectVCenter(ctx context.Context, id int, vcenter *VCenter) (result workerResult) {
+	start := time.Now()
+	result.vcenter = vcenter
+	workers.set(id, vcenter.Hostname, "connect")
+	vcenter.report("connecting", 0, 0)
+
+	releaseSlot, err := config.sessions.acquire(ctx, vcenter)
+	if err == nil {
+		if err = config.pool.connect(ctx, vcenter, config); err != nil {
+			releaseSlot()
+		}
+	}
+	if err != nil {
+		slog.Error("could not connect", "worker", id, "vcenter", vcenter.Hostname, "phase", "connect", "error", err)
+		workers.set(id, "", "")
+		vcenter.report("failed", 0, 0)
+		result.err = classify("connect", err)
+		result.duration = time.Since(start)
+		result.connectTime = result.duration
+		result.apiCalls = vcenter.calls.take()
+		return result
+	}
+	defer func() {
+		result.logoutErr = config.pool.release(ctx, vcenter)
+		releaseSlot()
+		workers.set(id, "", "")
+	}()
+
+	collectStart := time.Now()
+	result.connectTime = collectStart.Sub(start)
+	workers.set(id, vcenter.Hostname, "collect")
+	vcenter.report("retrieving", 0, 0)
+	if err := vcenter.Init(ctx, config, &result.collected); err == nil {
+		slog.Info("done", "worker", id, "vcenter", vcenter.Hostname, "phase", "collect", "duration", time.Since(collectStart))
+
+	} else {
+		result.err = classify("collect", err)
+		if ctx.Err() == nil {
+			slog.Error("collection failed", "worker", id, "vcenter", vcenter.Hostname, "phase", "collect", "hosts", len(result.collected.Data), "error", err)
+		}
+		if config.DiscardPartialResults && len(result.collected.Data) > 0 {
+			slog.Warn("discarding the hosts collected before the failure", "worker", id, "vcenter", vcenter.Hostname, "hosts", len(result.collected.Data))
+			result.collected = hostResults{}
+		}
+	}
+	result.collectTime = time.Since(collectStart)
+	result.duration = time.Since(start)
+	result.apiCalls = vcenter.calls.take()
+	if result.err != nil {
+		vcenter.report("failed", len(result.collected.Data), 0)
+	} else {
+		vcenter.report("done", result.collected.hosts(), 0)
+	}
+	return result
+}
+
+// Mailit mails the main output as an attachment, giving up when ctx is done
+func (config *Configuration) Mailit(ctx context.Context) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", config.Mail.From)
+	m.SetHeader("To", config.Mail.To)
+	m.SetHeader("Subject", config.Mail.Subject)
+	m.SetBody("text/html", config.Mail.Body)
+	m.Attach(config.Outpath)
+	return config.sendMail(ctx, m)
+}
+
+// Connect logs in to the vcenter, bounded by ConnectTimeoutSeconds
+func (vcenter *VCenter) Connect(ctx context.Context, config Configuration) error {
+	ctx, cancel := config.connectContext(ctx)
+	defer cancel()
+
+	logger := vcenter.logger().With("phase", "connect")
+	logger.Info("connecting")
+	password, err := vcenter.password()
+	if err != nil {
+		logger.Error("could not read password file", "error", err)
+		return err
+	}
+
+	u, err := sdkURL(vcenter.Hostname, vcenter.Username, password)
+	if err != nil {
+		logger.Error("could not parse vcenter url", "error", err)
+		return err
+	}
+
+	soapClient := soap.NewClient(u, true)
+	proxy, err := vcenter.setProxy(soapClient, u)
+	if err != nil {
+		logger.Error("could not configure proxy", "error", err)
+		return err
+	}
+
+	vcenter.limit(soapClient, config)
+	vcenter.countCalls(soapClient)
+
+	sessionFile := config.sessionFile(vcenter)
+	vcenter.keepSession = sessionFile != "" && !config.logout
+	vcenter.logoutTimeout = config.logoutTimeout()
+	if sessionFile != "" {
+		vcenter.loadSession(soapClient, sessionFile)
+	}
+
+	vimClient, err := vim25.NewClient(ctx, soapClient)
+	if err != nil {
+		err = proxyError(err, proxy)
+		logger.Error("could not connect", "error", err)
+		return err
+	}
+
+	client := &govmomi.Client{
+		Client:         vimClient,
+		SessionManager: session.NewManager(vimClient),
+	}
+
+	vcenter.client = client
+	vcenter.loginURL = u
+
+	if sessionFile != "" && vcenter.resumeSession(ctx, sessionFile) {
+		logger.Info("reusing cached session")
+		return nil
+	}
+
+	if err := vcenter.login(ctx, client, u); err != nil {
+		vcenter.client = nil
+		err = proxyError(err, proxy)
+		logger.Error("could not login", "error", err)
+		return err
+	}
+
+	if sessionFile != "" {
+		if err := vcenter.saveSession(sessionFile); err != nil {
+			logger.Warn("could not cache session", "error", err)
+		}
+	}
+
+	return nil
+}
+
+// credentialsURL is the sdk url of the vcenter with its current credentials, the password read again
+func (vcenter *VCenter) credentialsURL() (*url.URL, error) {
+	password, err := vcenter.password()
+	if err != nil {
+		return nil, err
+	}
+	return sdkURL(vcenter.Hostname, vcenter.Username, password)
+}
+
+// sdkURL builds the vcenter sdk url, hostname may carry a port and IPv6 literals may be bracketed or bare
+func sdkURL(hostname, username, password string) (*url.URL, error) {
+	host := strings.TrimSpace(hostname)
+	if host == "" {
+		return nil, fmt.Errorf("empty hostname")
+	}
+
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil && strings.Contains(host, ":") {
+		host = "[" + ip.String() + "]"
+	} else if strings.Contains(host, ":") {
+		name, port, err := net.SplitHostPort(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hostname %q: %v", hostname, err)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port %q in hostname %q", port, hostname)
+		}
+		host = net.JoinHostPort(name, port)
+	}
+
+	return &url.URL{
+		Scheme: "https",
+		User:   url.UserPassword(username, password),
+		Host:   host,
+		Path:   "/sdk",
+	}, nil
+}
+
+// Disconnect logs out of the vcenter unless its session is kept. A cancelled ctx still logs out,
+// so a shutdown doesn't leave sessions behind, but the logout gives up after LogoutTimeoutSeconds.
+func (vcenter *VCenter) Disconnect(ctx context.Context) error {
+	timeout := vcenter.logoutTimeout
+	if timeout <= 0 {
+		timeout = defaultLogoutTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	if vcenter.client != nil && !vcenter.keepSession {
+		vcenter.forgetSession()
+		if err := vcenter.client.Logout(ctx); err != nil {
+			vcenter.logger().Warn("could not disconnect properly", "phase", "disconnect", "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Init collects the hosts of the vcenter into out, which keeps what was collected before a failure
+func (vcenter *VCenter) Init(ctx context.Context, config Configuration, out *hostResults) error {
+	logger := vcenter.logger().With("phase", "collect")
+	logger.Info("collecting data")
+	ctx, cancel := config.collectContext(ctx)
+	defer cancel()
+
+	client := vcenter.client
+	result, err := collector.Collect(ctx, collector.VCenterConfig{
+		Client:          client.Client,
+		Datacenters:     vcenter.Datacenters,
+		Properties:      config.hostProperties(),
+		Concurrency:     vcenter.hostConcurrency(config),
+		RetrieveTimeout: time.Duration(config.RetrieveTimeoutSeconds) * time.Second,
+		Clusters:        vcenterNames{cache: config.names(), vcenter: vcenter.Hostname},
+	})
+	var lookupErr *collector.LookupError
+	if err != nil && !errors.As(err, &lookupErr) {
+		return err
+	}
+	for _, name := range result.MissingDatacenters {
+		logger.Warn("no such datacenter", "datacenter", name)
+	}
+	hss := result.Systems
+
+	if config.countOnly {
+		out.hostCount = len(hss)
+		return nil
+	}
+
+	pc := property.DefaultCollector(client.Client)
+	lookups := &lookupErrors{include: config.IncludePartialRows, logger: logger}
+
+	entering, err := enteringMaintenance(ctx, pc, hss)
+	if err != nil {
+		logger.Warn("could not look up maintenance tasks, MaintenanceState will not show entering", "error", err)
+		lookups.note(fmt.Errorf("could not look up maintenance tasks: %w", err))
+	}
+	tagValues, err := vcenter.hostTags(ctx, config, hss)
+	if err != nil {
+		logger.Warn("could not look up tags, tag and attribute columns will be empty", "error", err)
+		lookups.note(fmt.Errorf("could not look up tags: %w", err))
+	}
+	boots, err := config.bootDevices(ctx, client.Client, hss)
+	if err != nil {
+		logger.Warn("could not query the boot device of every host, BootDevice is unknown for those", "error", err)
+	}
+	local, err := localDatastores(ctx, pc, hss)
+	if err != nil {
+		if err = lookups.fail(fmt.Errorf("could not retrieve the datastores: %w", err)); err != nil {
+			return err
+		}
+	}
+	vcpus, err := provisionedVCPUs(ctx, pc, hss)
+	if err != nil {
+		if err = lookups.fail(fmt.Errorf("could not retrieve the vms: %w", err)); err != nil {
+			return err
+		}
+	}
+
+	if config.ClusterOutpath != "" {
+		out.clusters, err = clusterStats(ctx, pc, vcenter.DisplayName(), hss)
+		if err != nil {
+			return fmt.Errorf("could not retrieve the clusters: %w", err)
+		}
+	}
+
+	out.lookupTime = result.LookupTime
+	if lookupErr != nil {
+		if lookupErr.Clusters != nil {
+			if err = lookups.fail(fmt.Errorf("could not look up the clusters of the hosts: %w", lookupErr.Clusters)); err != nil {
+				return err
+			}
+		}
+		if lookupErr.Datacenters != nil {
+			if err = lookups.fail(fmt.Errorf("could not look up the datacenters of the hosts: %w", lookupErr.Datacenters)); err != nil {
+				return err
+			}
+		}
+	}
+	for i, hs := range hss {
+		markActivity()
+		vcenter.report("retrieving", i, len(hss))
+		if ctx.Err() != nil {
+			logger.Warn("shutting down, keeping the hosts collected so far", "hosts", len(out.Data), "total", len(hss))
+			return ctx.Err()
+		}
+		err := recovered(func() {
+			host := result.Hosts[i]
+			var hostErrs []string
+			if hs.Parent != nil && (lookupErr == nil || lookupErr.Clusters == nil) && host.Cluster == "" {
+				hostErrs = append(hostErrs, "could not resolve the cluster "+hs.Parent.Value)
+			}
+			stats := hostStat{
+				Datacenter:         host.Datacenter,
+				Cluster:            host.Cluster,
+				DrsEnabled:         host.DrsEnabled,
+				DrsAutomationLevel: host.DrsAutomationLevel,
+				Host:               host.Host,
+				ConnectionState:    host.ConnectionState,
+				Version:            host.Version,
+				Build:              host.Build,
+				FullVersion:        host.FullVersion,
+				Vendor:             host.Vendor,
+				Model:              host.Model,
+				NumCpuPkgs:         host.NumCpuPkgs,
+				NumCpuCores:        host.NumCpuCores,
+				NumCpuThreads:      host.NumCpuThreads,
+				CpuModel:           host.CpuModel,
+				TotalCPU:           host.TotalCPU,
+				FreeCPU:            host.FreeCPU,
+				CpuUsagePercent:    host.CpuUsagePercent,
+				OverallMemoryUsage: host.OverallMemoryUsage,
+				MemorySize:         host.MemorySize,
+				FreeMemory:         host.FreeMemory,
+				MemoryUsagePercent: host.MemoryUsagePercent,
+				NtpServers:         host.NtpServers,
+				NtpRunning:         host.NtpRunning,
+				MaintenanceMode:    host.MaintenanceMode,
+				PowerState:         host.PowerState,
+				VCenter:            vcenter.DisplayName(),
+				Site:               config.site(host.Host),
+				MoRef:              host.MoRef,
+				Labels:             labelValues(vcenter.Labels, config.labelKeys),
+				Tags:               labelValues(tagValues[hs.Reference().Value], config.tagColumns()),
+			}
+			stats.BootDevice = bootDevice(hs, boots[hs.Reference().Value])
+			stats.VMotionEnabled = nicTypeEnabled(hs, types.HostVirtualNicManagerNicTypeVmotion)
+			stats.FtSupported = ftSupported(hs)
+			stats.FtLoggingEnabled = nicTypeEnabled(hs, types.HostVirtualNicManagerNicTypeFaultToleranceLogging)
+			stats.DeadStoragePaths = deadPaths(hs)
+			if config.MemorySizeBytes {
+				stats.MemorySizeBytes = stats.MemorySize
+			}
+			if hs.Capability != nil {
+				stats.MaxRunningVMs = hs.Capability.MaxRunningVMs
+				stats.MaxSupportedVMs = hs.Capability.MaxSupportedVMs
+				stats.MaxRegisteredVMs = hs.Capability.MaxRegisteredVMs
+				stats.MaxSupportedVcpus = hs.Capability.MaxSupportedVcpus
+			}
+			if hs.Summary.Runtime != nil {
+				stats.StandbyMode = hs.Summary.Runtime.StandbyMode
+			}
+			switch {
+			case stats.MaintenanceMode:
+				stats.MaintenanceState = "in"
+			case entering[hs.Reference().Value]:
+				stats.MaintenanceState = "entering"
+			default:
+				stats.MaintenanceState = "none"
+			}
+			stats.ProvisionedVCPU = vcpus[hs.Reference().Value]
+			if stats.NumCpuCores > 0 {
+				stats.VcpuOvercommitRatio = float64(stats.ProvisionedVCPU) / float64(stats.NumCpuCores)
+			}
+			space := local[hs.Reference().Value]
+			stats.LocalDatastores = space.count
+			stats.LocalDatastoreCapacity = space.capacity
+			stats.LocalDatastoreFree = space.free
+			stats.FreeCpuDelta, stats.FreeMemoryDelta = config.deltas(stats)
+			stats.EstimatedFreeVMs = config.estimatedFreeVMs(stats)
+			stats.Error = lookups.hostError(hostErrs...)
+			row := append(hostStat.Slice(stats), labelColumns(stats.Labels, config.labelKeys)...)
+			row = append(row, labelColumns(stats.Tags, config.tagColumns())...)
+			// everything of the host is read before any of it is kept, so a host that panics leaves nothing behind
+			switches, features, hbas := hostSwitches(stats.Host, hs), hostCPUFeatures(stats.Host, hs), hostHBAs(stats.Host, hs)
+			out.Data = append(out.Data, config.pick(row))
+			out.stats = append(out.stats, stats)
+			out.switches = append(out.switches, switches...)
+			out.cpuFeatures = append(out.cpuFeatures, features...)
+			out.hbas = append(out.hbas, hbas...)
+			if config.dumpRaw != "" {
+				out.raw = append(out.raw, rawHost{VCenter: vcenter.Hostname, Host: hs.Reference().Value, Summary: hs.Summary})
+			}
+		})
+		if err != nil {
+			logger.Error("skipping host that could not be processed", "host", hs.Summary.Config.Name, "moref", hs.Reference().Value, "error", err)
+			out.skippedHosts++
+		}
+
+	}
+
+	return nil
+
+}
+
+// site extracts the site code from a host name with SiteRegex, empty when it doesn't match
+func (config Configuration) site(host string) string {
+	if config.siteRegex == nil {
+		return ""
+	}
+	match := config.siteRegex.FindStringSubmatch(host)
+	if match == nil {
+		return ""
+	}
+	return match[config.siteRegex.SubexpIndex("site")]
+}
+
+// csvExport writes the headers and all rows to path in one go, replacing the file, with the csv options
+// given. Outputs are only written once everything is collected, so a vcenter collected again never adds its rows twice.
+func csvExport(headers []string, data [][]string, path string, options json.RawMessage) error {
+	records := make([]writers.Record, len(data))
+	for i, row := range data {
+		records[i].Row = row
+	}
+	return writeOutput(path, func(w io.Writer) error {
+		return writers.Write(context.Background(), w, "csv", options, headers, records)
+	})
+}
+
+// jsonExport writes records as JSON, indented with two spaces when pretty is set
+func jsonExport(records interface{}, path string, pretty bool) error {
+	var out []byte
+	var err error
+	if pretty {
+		out, err = json.MarshalIndent(records, "", "  ")
+	} else {
+		out, err = json.Marshal(records)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(path, func(w io.Writer) error {
+		_, err := w.Write(append(out, '\n'))
+		return err
+	})
+}
+
+// exportTable writes a secondary output to path in the configured format, with the global column rules applied
+func (config Configuration) exportTable(path string, headers []string, rows [][]string, records interface{}) error {
+	return config.tableOutput(path, headers).write(rows, records)
+}
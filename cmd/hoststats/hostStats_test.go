@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/units"
+)
+
+// newSimulator starts a vcsim with the vcenter model after configure changes it and returns a
+// vcenter logging in to it. vcsim keeps its inventory in a global registry, so only one runs at a time.
+func newSimulator(t *testing.T, configure func(*simulator.Model)) *VCenter {
+	t.Helper()
+	model := simulator.VPX()
+	if configure != nil {
+		configure(model)
+	}
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(model.Remove)
+	model.Service.TLS = new(tls.Config)
+	server := model.Service.NewServer()
+	t.Cleanup(server.Close)
+	return &VCenter{VCenter: settings.VCenter{Hostname: server.URL.Host, Username: "user", Password: "pass"}}
+}
+
+// soapProxy sits in front of a vcenter and hands each SOAP call to intercept first, by the name of
+// its method. When intercept returns false the call was answered by it, otherwise it goes on to the vcenter.
+func soapProxy(t *testing.T, vcenter *VCenter, intercept func(method string, w http.ResponseWriter, r *http.Request) bool) *VCenter {
+	t.Helper()
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "https", Host: vcenter.Hostname})
+	proxy.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if !intercept(soapMethod(body), w, r) {
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	proxied := *vcenter
+	proxied.Hostname = server.Listener.Addr().String()
+	return &proxied
+}
+
+// soapMethod is the name of the method a SOAP request calls, the first element in its body
+func soapMethod(request []byte) string {
+	_, after, ok := bytes.Cut(request, []byte("Body>"))
+	if !ok {
+		return ""
+	}
+	after = bytes.TrimSpace(after)
+	if len(after) == 0 || after[0] != '<' {
+		return ""
+	}
+	name := after[1:]
+	if end := bytes.IndexAny(name, " />"); end >= 0 {
+		name = name[:end]
+	}
+	if _, local, ok := bytes.Cut(name, []byte(":")); ok {
+		name = local
+	}
+	return string(name)
+}
+
+// failCalls makes a soapProxy intercept fail the first n calls of method with a server error
+func failCalls(method string, n int) func(string, http.ResponseWriter, *http.Request) bool {
+	var mu sync.Mutex
+	return func(called string, w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if called != method || n == 0 {
+			return true
+		}
+		n--
+		http.Error(w, "injected failure of "+method, http.StatusInternalServerError)
+		return false
+	}
+}
+
+// hangCalls makes a soapProxy intercept never answer method, until the client gives up
+func hangCalls(method string) func(string, http.ResponseWriter, *http.Request) bool {
+	return func(called string, w http.ResponseWriter, r *http.Request) bool {
+		if called != method {
+			return true
+		}
+		<-r.Context().Done()
+		return false
+	}
+}
+
+// runCollection prepares config as main does, without flags, and runs one collection
+func runCollection(t *testing.T, config Configuration) runSummary {
+	t.Helper()
+	if err := config.prepare(options{}); err != nil {
+		t.Fatal(err)
+	}
+	return collect(context.Background(), config, false)
+}
+
+// readRows reads a csv output into a map per row from column to value
+func readRows(t *testing.T, path string) []map[string]string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, data, err := readCSV(b, ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := make([]map[string]string, len(data))
+	for i, values := range data {
+		if len(values) != len(header) {
+			t.Fatalf("row %d has %d values for %d columns", i+1, len(values), len(header))
+		}
+		rows[i] = make(map[string]string)
+		for j, column := range header {
+			rows[i][column] = values[j]
+		}
+	}
+	return rows
+}
+
+func TestEmptyVCenter(t *testing.T) {
+	vcenter := newSimulator(t, func(m *simulator.Model) {
+		m.Host, m.Cluster, m.ClusterHost, m.Machine = 0, 0, 0, 0
+	})
+	path := filepath.Join(t.TempDir(), "hosts.csv")
+
+	summary := runCollection(t, Configuration{Config: settings.Config{Outpath: path}, VCenters: []*VCenter{vcenter}})
+	if summary.ExitCode != 0 {
+		t.Fatalf("exit code %d, want 0", summary.ExitCode)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 1 || !strings.Contains(","+lines[0]+",", ",Host,") {
+		t.Errorf("output of a vcenter without hosts is %q, want just the header", b)
+	}
+}
+
+func TestEmptyVCenterSkipEmptyOutput(t *testing.T) {
+	vcenter := newSimulator(t, func(m *simulator.Model) {
+		m.Host, m.Cluster, m.ClusterHost, m.Machine = 0, 0, 0, 0
+	})
+	path := filepath.Join(t.TempDir(), "hosts.csv")
+	previous := []byte("Datacenter,Cluster,Host\nDC0,C0,esx-01\n")
+	if err := os.WriteFile(path, previous, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := runCollection(t, Configuration{Config: settings.Config{Outpath: path, Overwrite: true, SkipEmptyOutput: true}, VCenters: []*VCenter{vcenter}})
+	if summary.ExitCode != 0 {
+		t.Fatalf("exit code %d, want 0", summary.ExitCode)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("the previous output is gone: %v", err)
+	}
+	if string(b) != string(previous) {
+		t.Errorf("the previous output was changed to %q", b)
+	}
+}
+
+// the vcsim hosts have 4294430720 bytes of memory and use 1404MB of it
+func TestMemoryColumns(t *testing.T) {
+	const size, used = 4294430720, 1404 * 1024 * 1024
+	vcenter := newSimulator(t, nil)
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "hosts.csv")
+	runCollection(t, Configuration{Config: settings.Config{Outpath: csvPath, MemorySizeBytes: true}, VCenters: []*VCenter{vcenter}})
+	rows := readRows(t, csvPath)
+	if len(rows) == 0 {
+		t.Fatal("no hosts written")
+	}
+	for _, row := range rows {
+		if row["MemorySize"] != units.ByteSize(size).String() || row["MemorySizeBytes"] != strconv.Itoa(size) {
+			t.Errorf("host %s has MemorySize %s and MemorySizeBytes %s, want %s and %d", row["Host"], row["MemorySize"], row["MemorySizeBytes"], units.ByteSize(size), size)
+		}
+		if row["OverallMemoryUsage"] != units.ByteSize(used).String() {
+			t.Errorf("host %s has OverallMemoryUsage %s, want %s", row["Host"], row["OverallMemoryUsage"], units.ByteSize(used))
+		}
+	}
+
+	jsonPath := filepath.Join(dir, "hosts.json")
+	runCollection(t, Configuration{Config: settings.Config{Outpath: jsonPath, Format: "json"}, VCenters: []*VCenter{vcenter}})
+	b, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hosts []hostStat
+	if err := json.Unmarshal(b, &hosts); err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != len(rows) {
+		t.Fatalf("%d hosts in json, %d in csv", len(hosts), len(rows))
+	}
+	for _, s := range hosts {
+		if s.MemorySize != size || s.OverallMemoryUsage != used {
+			t.Errorf("host %s has MemorySize %d and OverallMemoryUsage %d, want %d and %d", s.Host, s.MemorySize, s.OverallMemoryUsage, size, used)
+		}
+	}
+}
+
+// a json output with ErrorReport has the hosts under Hosts next to the failed vcenters, indented with PrettyJSON
+func TestJSONErrorReport(t *testing.T) {
+	vcenter := newSimulator(t, nil)
+	failing := soapProxy(t, vcenter, failCalls("Login", 100))
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	runCollection(t, Configuration{Config: settings.Config{Outpath: path, Format: "json", ErrorReport: true, PrettyJSON: true}, VCenters: []*VCenter{vcenter, failing}})
+
+	b := readFile(t, path)
+	if !strings.HasPrefix(b, "{\n  \"Hosts\": [\n    {\n") {
+		t.Errorf("output starts with %q, want it indented", b[:min(len(b), 40)])
+	}
+	var report struct {
+		Hosts  []hostStat
+		Errors []errorRecord
+	}
+	if err := json.Unmarshal([]byte(b), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Hosts) != 4 || len(report.Errors) != 1 {
+		t.Errorf("%d hosts and %d errors, want 4 and 1", len(report.Hosts), len(report.Errors))
+	}
+}
+
+// each value of Slice has to be under its column of Headers
+func TestHostStatColumns(t *testing.T) {
+	cpuDelta := int64(-200)
+	s := hostStat{
+		Datacenter:         "DC0",
+		Cluster:            "C0",
+		Host:               "esx-01",
+		NumCpuCores:        16,
+		TotalCPU:           40000,
+		CpuUsagePercent:    12.5,
+		OverallMemoryUsage: 1024 * 1024 * 1024,
+		MemorySize:         4 * 1024 * 1024 * 1024,
+		NtpRunning:         true,
+		MaintenanceState:   "entering",
+		FreeCpuDelta:       &cpuDelta,
+		MoRef:              "host-21",
+		Error:              "could not resolve the cluster domain-c7",
+		Labels:             map[string]string{"env": "prod"},
+	}
+	want := map[string]string{
+		"Datacenter":         "DC0",
+		"Cluster":            "C0",
+		"Host":               "esx-01",
+		"NumCpuCores":        "16",
+		"NumCpuPkgs":         "0",
+		"TotalCPU":           "40000",
+		"CpuUsagePercent":    "12.50",
+		"OverallMemoryUsage": "1.0GB",
+		"MemorySize":         "4.0GB",
+		"FreeMemory":         "0B",
+		"NtpRunning":         "true",
+		"MaintenanceMode":    "false",
+		"MaintenanceState":   "entering",
+		"FreeCpuDelta":       "-200",
+		"FreeMemoryDelta":    "",
+		"MoRef":              "host-21",
+		"Error":              "could not resolve the cluster domain-c7",
+	}
+
+	headers, values := s.Headers(), s.Slice()
+	if len(headers) != len(values) {
+		t.Fatalf("%d headers and %d values", len(headers), len(values))
+	}
+	seen := make(map[string]bool)
+	for i, header := range headers {
+		if seen[header] {
+			t.Errorf("column %s twice", header)
+		}
+		seen[header] = true
+		if v, ok := want[header]; ok && values[i] != v {
+			t.Errorf("column %s is %q, want %q", header, values[i], v)
+		}
+	}
+	for column := range want {
+		if !seen[column] {
+			t.Errorf("no column %s", column)
+		}
+	}
+	for _, column := range []string{"Labels", "Tags"} {
+		if seen[column] {
+			t.Errorf("%s written as a column of its own", column)
+		}
+	}
+}
+
+func TestSdkURL(t *testing.T) {
+	tests := []struct {
+		hostname string
+		password string
+		host     string
+	}{
+		{"vc.example.com", "secret", "vc.example.com"},
+		{"vc.example.com:10443", "secret", "vc.example.com:10443"},
+		{" vc.example.com ", "secret", "vc.example.com"},
+		{"[2001:db8::10]:8443", "secret", "[2001:db8::10]:8443"},
+		{"[2001:db8::10]", "secret", "[2001:db8::10]"},
+		{"2001:db8::10", "secret", "[2001:db8::10]"},
+		{"192.0.2.10:443", "secret", "192.0.2.10:443"},
+		{"vc.example.com", "p@ss/word", "vc.example.com"},
+		{"vc.example.com", "50%#off ?", "vc.example.com"},
+		{"[2001:db8::10]:8443", "a@b:c/d", "[2001:db8::10]:8443"},
+	}
+	for _, tt := range tests {
+		u, err := sdkURL(tt.hostname, "administrator@vsphere.local", tt.password)
+		if err != nil {
+			t.Errorf("sdkURL(%q): %v", tt.hostname, err)
+			continue
+		}
+		if u.Host != tt.host {
+			t.Errorf("sdkURL(%q) host = %q, want %q", tt.hostname, u.Host, tt.host)
+		}
+
+		// what soap connects to is the url as text, it has to parse back to the same credentials and host
+		parsed, err := url.Parse(u.String())
+		if err != nil {
+			t.Errorf("sdkURL(%q, %q) does not parse back: %v", tt.hostname, tt.password, err)
+			continue
+		}
+		if password, _ := parsed.User.Password(); password != tt.password {
+			t.Errorf("sdkURL(%q, %q) password parses back as %q", tt.hostname, tt.password, password)
+		}
+		if parsed.User.Username() != "administrator@vsphere.local" {
+			t.Errorf("sdkURL(%q) username parses back as %q", tt.hostname, parsed.User.Username())
+		}
+		if parsed.Host != tt.host || parsed.Path != "/sdk" || parsed.Scheme != "https" {
+			t.Errorf("sdkURL(%q, %q) parses back as %s", tt.hostname, tt.password, parsed.Redacted())
+		}
+	}
+}
+
+func TestSdkURLInvalid(t *testing.T) {
+	for _, hostname := range []string{"", "  ", "vc.example.com:0", "vc.example.com:65536", "vc.example.com:https", "vc.example.com:443:1"} {
+		if u, err := sdkURL(hostname, "user", "secret"); err == nil {
+			t.Errorf("sdkURL(%q) = %s, want an error", hostname, u.Redacted())
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+// loadVCentersFile reads the vcenters from the VCentersFile and merges them into the configuration.
+// A hostname listed both inline and in the file is an error.
+func (config *Configuration) loadVCentersFile() error {
+	if config.VCentersFile == "" {
+		return nil
+	}
+
+	entries, err := settings.ReadVCenters(config.VCentersFile)
+	if err != nil {
+		return fmt.Errorf("could not read vcenters file %s: %v", config.VCentersFile, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, vcenter := range config.VCenters {
+		seen[strings.ToLower(vcenter.Hostname)] = true
+	}
+	for _, vcenter := range newVCenters(entries) {
+		key := strings.ToLower(vcenter.Hostname)
+		if seen[key] {
+			return fmt.Errorf("vcenter %s is listed more than once in configuration and %s", vcenter.Hostname, config.VCentersFile)
+		}
+		seen[key] = true
+		config.VCenters = append(config.VCenters, vcenter)
+	}
+
+	return nil
+}
+
+// canonicalHostname is a vcenter hostname written one way to compare it: lowercase, without a scheme,
+// path or trailing slash and without the default port, so "https://VC01.dc.lab:443/sdk" is "vc01.dc.lab"
+func canonicalHostname(hostname string) string {
+	host := strings.ToLower(strings.TrimSpace(hostname))
+	for _, scheme := range []string{"https://", "http://"} {
+		host = strings.TrimPrefix(host, scheme)
+	}
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	if name, port, err := net.SplitHostPort(host); err == nil && port == "443" {
+		if strings.Contains(name, ":") {
+			return "[" + name + "]"
+		}
+		return name
+	}
+	return host
+}
+
+// rejectDuplicateVCenters rejects a vcenter listed twice, it would be collected twice and every host
+// counted twice. Hostnames are compared canonicalized, they are connected to and written as configured.
+func (config *Configuration) rejectDuplicateVCenters() error {
+	seen := make(map[string]string)
+	for _, vcenter := range config.VCenters {
+		key := canonicalHostname(vcenter.Hostname)
+		if first, ok := seen[key]; ok {
+			return fmt.Errorf("vcenter %s is listed more than once, also as %s", vcenter.Hostname, first)
+		}
+		seen[key] = vcenter.Hostname
+	}
+	return nil
+}
+
+// stringList is a flag that can be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// selectVCenters keeps the vcenters whose Hostname or Name matches one of the glob patterns.
+// Every pattern has to match at least one vcenter.
+func selectVCenters(vcenters []*VCenter, patterns []string) ([]*VCenter, error) {
+	if len(patterns) == 0 {
+		return vcenters, nil
+	}
+
+	var selected []*VCenter
+	matched := make([]bool, len(patterns))
+	for _, vcenter := range vcenters {
+		keep := false
+		for i, pattern := range patterns {
+			if globMatch(pattern, vcenter.Hostname) || (vcenter.Name != "" && globMatch(pattern, vcenter.Name)) {
+				matched[i] = true
+				keep = true
+			}
+		}
+		if keep {
+			selected = append(selected, vcenter)
+		}
+	}
+
+	for i, pattern := range patterns {
+		if !matched[i] {
+			return nil, fmt.Errorf("no vcenter in configuration matches %q", pattern)
+		}
+	}
+
+	return selected, nil
+}
+
+func globMatch(pattern, name string) bool {
+	ok, err := filepath.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return err == nil && ok
+}
+
+// listVCenters prints the configured vcenters without connecting to them
+func listVCenters(w io.Writer, vcenters []*VCenter) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOSTNAME\tNAME\tUSERNAME")
+	for _, vcenter := range vcenters {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", vcenter.Hostname, vcenter.Name, vcenter.Username)
+	}
+	tw.Flush()
+}
+
+// printCounts prints the number of hosts per vcenter and in total, for -count
+func printCounts(w io.Writer, vcenters []*VCenter) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	total := 0
+	fmt.Fprintln(tw, "VCENTER\tHOSTS")
+	for _, vcenter := range vcenters {
+		fmt.Fprintf(tw, "%s\t%d\n", vcenter.DisplayName(), vcenter.hostCount)
+		total += vcenter.hostCount
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d\n", total)
+	tw.Flush()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+func TestCanonicalHostname(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{"vc01.dc.lab", "vc01.dc.lab"},
+		{"VC01.DC.lab", "vc01.dc.lab"},
+		{"https://VC01.dc.lab:443/sdk", "vc01.dc.lab"},
+		{"http://vc01.dc.lab/", "vc01.dc.lab"},
+		{" vc01.dc.lab:443 ", "vc01.dc.lab"},
+		{"vc01.dc.lab:8443", "vc01.dc.lab:8443"},
+		{"[2001:db8::10]:443", "[2001:db8::10]"},
+		{"[2001:db8::10]:8443", "[2001:db8::10]:8443"},
+	}
+	for _, tt := range tests {
+		if got := canonicalHostname(tt.hostname); got != tt.want {
+			t.Errorf("canonicalHostname(%q) = %q, want %q", tt.hostname, got, tt.want)
+		}
+	}
+}
+
+func TestRejectDuplicateVCenters(t *testing.T) {
+	tests := []struct {
+		name      string
+		vcenters  []*VCenter
+		duplicate bool
+	}{
+		{"different vcenters", []*VCenter{{VCenter: settings.VCenter{Hostname: "vc01.dc.lab"}}, {VCenter: settings.VCenter{Hostname: "vc02.dc.lab"}}}, false},
+		{"different ports", []*VCenter{{VCenter: settings.VCenter{Hostname: "vc01.dc.lab"}}, {VCenter: settings.VCenter{Hostname: "vc01.dc.lab:8443"}}}, false},
+		{"same hostname", []*VCenter{{VCenter: settings.VCenter{Hostname: "vc01.dc.lab"}}, {VCenter: settings.VCenter{Hostname: "vc01.dc.lab"}}}, true},
+		{"written differently", []*VCenter{{VCenter: settings.VCenter{Hostname: "vc01.dc.lab"}}, {VCenter: settings.VCenter{Hostname: "https://VC01.dc.lab:443/sdk"}}}, true},
+		{"other user", []*VCenter{{VCenter: settings.VCenter{Hostname: "vc01.dc.lab", Username: "a"}}, {VCenter: settings.VCenter{Hostname: "VC01.dc.lab", Username: "b"}}}, true},
+	}
+	for _, tt := range tests {
+		var hostnames []string
+		for _, vcenter := range tt.vcenters {
+			hostnames = append(hostnames, vcenter.Hostname)
+		}
+		config := Configuration{VCenters: tt.vcenters}
+		err := config.rejectDuplicateVCenters()
+		if tt.duplicate && err == nil {
+			t.Errorf("%s: not rejected", tt.name)
+		} else if !tt.duplicate && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		for i, vcenter := range tt.vcenters {
+			if vcenter.Hostname != hostnames[i] {
+				t.Errorf("%s: hostname %q changed to %q", tt.name, hostnames[i], vcenter.Hostname)
+			}
+		}
+	}
+}
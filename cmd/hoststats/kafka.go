@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	writers "github.com/BilboTheGreedy/hostStats/output"
+)
+
+// publish sends every host as a JSON message keyed by its host name, with the output's column
+// rules applied. It returns once all messages are acknowledged by the brokers or failed, or ctx is done.
+func (o *output) publish(ctx context.Context, rows [][]string, stats []hostStat) error {
+	records := o.written(rows, stats)
+	for i := range records {
+		records[i].Key = stats[i].Host
+	}
+	return writers.Write(ctx, io.Discard, o.Format, json.RawMessage(o.Options), o.columns, records)
+}
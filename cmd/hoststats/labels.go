@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var labelKeyRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// DisplayName returns the friendly Name of the vcenter, falling back to its Hostname
+func (vcenter *VCenter) DisplayName() string {
+	if vcenter.Name != "" {
+		return vcenter.Name
+	}
+	return vcenter.Hostname
+}
+
+// labelKeys returns the sorted union of label keys over all vcenters,
+// so every row gets the same label columns.
+func labelKeys(vcenters []*VCenter) ([]string, error) {
+	var Data hostStat
+	reserved := make(map[string]bool)
+	for _, header := range hostStat.Headers(Data) {
+		reserved[strings.ToLower(header)] = true
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	for _, vcenter := range vcenters {
+		for key := range vcenter.Labels {
+			if !labelKeyRegex.MatchString(key) {
+				return nil, fmt.Errorf("label %q on vcenter %s is not a valid column name", key, vcenter.DisplayName())
+			}
+			if reserved[strings.ToLower(key)] {
+				return nil, fmt.Errorf("label %q on vcenter %s clashes with a built-in column", key, vcenter.DisplayName())
+			}
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// labelValues returns the vcenter's labels with every key present, empty where undefined
+func labelValues(labels map[string]string, keys []string) map[string]string {
+	if len(keys) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		values[key] = labels[key]
+	}
+	return values
+}
+
+// labelColumns returns the label values in column order
+func labelColumns(labels map[string]string, keys []string) []string {
+	columns := make([]string, len(keys))
+	for i, key := range keys {
+		columns[i] = labels[key]
+	}
+	return columns
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// apiLimiter caps the requests sent to one vcenter. It sits on the soap client's transport,
+// so every API call made through that client is constrained, whatever collects it.
+type apiLimiter struct {
+	next http.RoundTripper
+	sem  chan struct{}
+
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// limit wraps the soap client's transport with the vcenter's limits, falling back to the global ones
+func (vcenter *VCenter) limit(client *soap.Client, config Configuration) {
+	concurrent := config.MaxConcurrentRequests
+	if vcenter.MaxConcurrentRequests > 0 {
+		concurrent = vcenter.MaxConcurrentRequests
+	}
+	rps := config.RequestsPerSecond
+	if vcenter.RequestsPerSecond > 0 {
+		rps = vcenter.RequestsPerSecond
+	}
+	if concurrent <= 0 && rps <= 0 {
+		return
+	}
+
+	l := &apiLimiter{next: client.Transport, rate: rps, tokens: 1, last: time.Now()}
+	if concurrent > 0 {
+		l.sem = make(chan struct{}, concurrent)
+	}
+	client.Transport = l
+}
+
+func (l *apiLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if err := l.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+			defer func() { <-l.sem }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return l.next.RoundTrip(req)
+}
+
+// wait takes a token from the bucket, sleeping until one is available.
+// The bucket holds at most one token so requests are evenly spaced.
+func (l *apiLimiter) wait(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > 1 {
+		l.tokens = 1
+	}
+	l.last = now
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// connectPause sleeps between handing out vcenters to the workers, so logins don't all start at once.
+// It returns early when ctx is cancelled.
+func (config Configuration) connectPause(ctx context.Context) {
+	pause := time.Duration(config.ConnectDelay)
+	if config.ConnectJitter > 0 {
+		pause += time.Duration(rand.Int63n(int64(config.ConnectJitter)))
+	}
+	if pause <= 0 {
+		return
+	}
+
+	t := time.NewTimer(pause)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// runDeadline applies RunTimeout to a run started at start. Outputs must be written within
+// RunTimeout, collecting stops a tenth of it earlier, at most a minute, to leave time for that.
+// Without RunTimeout both are ctx.
+func (config Configuration) runDeadline(ctx context.Context, start time.Time) (sinks, collecting context.Context, cancel context.CancelFunc) {
+	timeout := time.Duration(config.RunTimeout)
+	if timeout <= 0 {
+		return ctx, ctx, func() {}
+	}
+	reserve := timeout / 10
+	if reserve > time.Minute {
+		reserve = time.Minute
+	}
+	deadline := start.Add(timeout)
+	sinks, cancelSinks := context.WithDeadline(ctx, deadline)
+	collecting, cancelCollecting := context.WithDeadline(sinks, deadline.Add(-reserve))
+	return sinks, collecting, func() {
+		cancelCollecting()
+		cancelSinks()
+	}
+}
+
+// defaultConnectTimeout and defaultLogoutTimeout apply without ConnectTimeoutSeconds and LogoutTimeoutSeconds
+const (
+	defaultConnectTimeout = time.Minute
+	defaultLogoutTimeout  = 10 * time.Second
+)
+
+// connectContext bounds connecting and logging in to a vcenter by ConnectTimeoutSeconds
+func (config Configuration) connectContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := defaultConnectTimeout
+	if config.ConnectTimeoutSeconds > 0 {
+		timeout = time.Duration(config.ConnectTimeoutSeconds) * time.Second
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// collectContext bounds the whole collection from one vcenter by CollectTimeoutSeconds, ctx alone when it is not set
+func (config Configuration) collectContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if config.CollectTimeoutSeconds <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(config.CollectTimeoutSeconds)*time.Second)
+}
+
+// logoutTimeout bounds a logout by LogoutTimeoutSeconds
+func (config Configuration) logoutTimeout() time.Duration {
+	if config.LogoutTimeoutSeconds > 0 {
+		return time.Duration(config.LogoutTimeoutSeconds) * time.Second
+	}
+	return defaultLogoutTimeout
+}
+
+// retrieveContext bounds one retrieve by RetrieveTimeoutSeconds, ctx alone when it is not set
+func (config Configuration) retrieveContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if config.RetrieveTimeoutSeconds <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(config.RetrieveTimeoutSeconds)*time.Second)
+}
+
+// hostConcurrency is how many host retrieves run at once on the vcenter, falling back to the global MaxHostConcurrency
+func (vcenter *VCenter) hostConcurrency(config Configuration) int {
+	if vcenter.MaxHostConcurrency > 0 {
+		return vcenter.MaxHostConcurrency
+	}
+	if config.MaxHostConcurrency > 0 {
+		return config.MaxHostConcurrency
+	}
+	return 1
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+// only a retrieve that ran out of RetrieveTimeoutSeconds is a timeout, a retrieve failing on its own is not
+func TestRetrieveTimeoutClassification(t *testing.T) {
+	tests := []struct {
+		name        string
+		hang        bool
+		concurrency int
+		category    string
+	}{
+		{"failed", false, 0, "other"},
+		{"failed in batches", false, 2, "other"},
+		{"timed out", true, 0, "timeout"},
+		{"timed out in batches", true, 2, "timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intercept := failCalls("RetrieveProperties", 100)
+			if tt.hang {
+				intercept = hangCalls("RetrieveProperties")
+			}
+			vcenter := soapProxy(t, newSimulator(t, nil), intercept)
+			vcenter.MaxHostConcurrency = tt.concurrency
+
+			summary := runCollection(t, Configuration{
+				Config: settings.Config{
+					Outpath:                filepath.Join(t.TempDir(), "hosts.csv"),
+					RetrieveTimeoutSeconds: 1,
+				},
+				VCenters: []*VCenter{vcenter},
+			})
+			if s := summary.VCenters[0]; s.Status != "failed" || s.Category != tt.category {
+				t.Errorf("vcenter %s with category %q, want failed with %q: %s", s.Status, s.Category, tt.category, s.Error)
+			}
+		})
+	}
+}
+
+// a vcenter that stops answering fails with a timeout once the timeout of what it was doing runs out
+func TestHangingVCenterTimeouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		config Configuration
+	}{
+		{"connect", "RetrieveServiceContent", Configuration{Config: settings.Config{ConnectTimeoutSeconds: 1}}},
+		{"login", "Login", Configuration{Config: settings.Config{ConnectTimeoutSeconds: 1}}},
+		{"collect", "RetrieveProperties", Configuration{Config: settings.Config{CollectTimeoutSeconds: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.Outpath = filepath.Join(t.TempDir(), "hosts.csv")
+			config.VCenters = []*VCenter{soapProxy(t, newSimulator(t, nil), hangCalls(tt.method))}
+
+			start := time.Now()
+			summary := runCollection(t, config)
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("run took %s", elapsed)
+			}
+			if s := summary.VCenters[0]; s.Status != "failed" || s.Category != "timeout" {
+				t.Errorf("vcenter %s with category %q, want failed with timeout: %s", s.Status, s.Category, s.Error)
+			}
+		})
+	}
+}
+
+// a logout that hangs gives up after LogoutTimeoutSeconds without failing the run
+func TestHangingLogout(t *testing.T) {
+	vcenter := soapProxy(t, newSimulator(t, nil), hangCalls("Logout"))
+
+	start := time.Now()
+	summary := runCollection(t, Configuration{
+		Config: settings.Config{
+			Outpath:              filepath.Join(t.TempDir(), "hosts.csv"),
+			LogoutTimeoutSeconds: 1,
+		},
+		VCenters: []*VCenter{vcenter},
+	})
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("run took %s", elapsed)
+	}
+	if summary.ExitCode != 0 {
+		t.Errorf("exit code %d, want 0", summary.ExitCode)
+	}
+	if summary.LogoutFailures != 1 || summary.VCenters[0].LogoutError == "" {
+		t.Errorf("%d logout failures and error %q, want the logout to have timed out", summary.LogoutFailures, summary.VCenters[0].LogoutError)
+	}
+}
+
+// looking up the datacenters of the hosts is bounded by RetrieveTimeoutSeconds like retrieving them
+func TestDatacenterLookupTimeout(t *testing.T) {
+	// the walk up to the datacenters starts at the compute resources of the hosts
+	intercept := func(method string, w http.ResponseWriter, r *http.Request) bool {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if method == "RetrieveProperties" && bytes.Contains(body, []byte(`type="ComputeResource"`)) {
+			<-r.Context().Done()
+			return false
+		}
+		return true
+	}
+	summary := runCollection(t, Configuration{
+		Config: settings.Config{
+			Outpath:                filepath.Join(t.TempDir(), "hosts.csv"),
+			RetrieveTimeoutSeconds: 1,
+		},
+		VCenters: []*VCenter{soapProxy(t, newSimulator(t, nil), intercept)},
+	})
+	if s := summary.VCenters[0]; s.Status != "failed" || s.Category != "timeout" || !strings.Contains(s.Error, "datacenters") {
+		t.Errorf("vcenter %s with category %q, want failed looking up the datacenters with timeout: %s", s.Status, s.Category, s.Error)
+	}
+}
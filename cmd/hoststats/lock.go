@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runLock keeps a second instance from writing the same outputs, it is a file holding the pid and start time
+type runLock struct {
+	path string
+}
+
+// lockPath is LockFile, or the output path with .lock appended when only Lock is set. Empty means no lock.
+func (config Configuration) lockPath(now time.Time) string {
+	if config.LockFile != "" {
+		return config.LockFile
+	}
+	if !config.Lock {
+		return ""
+	}
+	path, err := expandTime(config.Outpath, now)
+	if err != nil {
+		// checked by prepare
+		path = config.Outpath
+	}
+	return path + ".lock"
+}
+
+// acquireLock takes the lock at path, waiting up to wait for another instance to release it.
+// A lock left behind by a process that is no longer running is broken.
+func acquireLock(path string, wait time.Duration) (*runLock, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		err := createLock(path)
+		if err == nil {
+			return &runLock{path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		pid, started, err := readLock(path)
+		if err == nil && !processAlive(pid) {
+			broken, err := breakLock(path, pid, started)
+			if err != nil {
+				return nil, err
+			}
+			if broken {
+				continue
+			}
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return nil, fmt.Errorf("%s is held by another run", path)
+			}
+			return nil, fmt.Errorf("%s is held by pid %d since %s", path, pid, started)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// staleBreak is how old a break file has to be before it is taken as left by a run that died while
+// breaking a lock, breaking takes milliseconds
+const staleBreak = 10 * time.Second
+
+// breakLock removes the stale lock at path held by the dead pid. Two runs finding the same stale
+// lock must not both take it, the second would remove the lock the first just created. So only the
+// run that creates path.break, exclusively, breaks it, and only after reading the lock again and
+// finding it still held by pid. It reports whether the lock was removed, or is gone already, and
+// false when another run is breaking it.
+func breakLock(path string, pid int, started string) (bool, error) {
+	breaking := path + ".break"
+	file, err := os.OpenFile(breaking, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if !errors.Is(err, os.ErrExist) {
+			return false, err
+		}
+		if info, err := os.Stat(breaking); err == nil && time.Since(info.ModTime()) > staleBreak {
+			os.Remove(breaking)
+		}
+		return false, nil
+	}
+	file.Close()
+	defer os.Remove(breaking)
+
+	current, currentStarted, err := readLock(path)
+	switch {
+	case os.IsNotExist(err):
+		return true, nil
+	case err != nil:
+		return false, err
+	case current != pid || currentStarted != started:
+		// taken over by another run since it was read
+		return false, nil
+	}
+	slog.Warn("breaking stale lock", "path", path, "pid", pid, "started", started)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+func createLock(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(file, "%d\n%s\n", os.Getpid(), time.Now().Format(time.RFC3339))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// readLock returns the pid and start time written by the holder
+func readLock(path string) (int, string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, "", err
+	}
+	lines := strings.SplitN(strings.TrimSpace(string(b)), "\n", 2)
+	pid, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: invalid pid: %v", path, err)
+	}
+	started := ""
+	if len(lines) > 1 {
+		started = strings.TrimSpace(lines[1])
+	}
+	return pid, started, nil
+}
+
+// processAlive reports whether a process with pid is running, on windows finding it is enough
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	defer p.Release()
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// release removes the lock, it is nil safe so runs without a lock can call it
+func (l *runLock) release() {
+	if l == nil {
+		return
+	}
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("could not remove lock", "path", l.path, "error", err)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTime is the rotation time in the name of a rotated file, like hoststats-20240131-235959.000.log
+const backupTime = "20060102-150405.000"
+
+// rename moves the file aside on rotation, a variable so the windows fallback can be tested anywhere
+var rename = os.Rename
+
+// rotatingFile is a log file that is rotated when it grows past maxSize.
+// Rotated files get the rotation time in their name, beyond maxBackups or older than maxAge they are removed.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSizeMB int, maxBackups int, maxAgeDays int) (*rotatingFile, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = 100
+	}
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+		maxAge:     time.Duration(maxAgeDays) * 24 * time.Hour,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.prune()
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			// keep logging to the current file rather than losing lines
+			fmt.Fprintln(os.Stderr, "could not rotate log file", r.path, err)
+		}
+	}
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file aside and starts a new one. On windows a file another
+// process holds open can't be renamed, it is then copied to the backup and truncated.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+
+	ext := filepath.Ext(r.path)
+	backup := strings.TrimSuffix(r.path, ext) + "-" + time.Now().Format(backupTime) + ext
+	if err := rename(r.path, backup); err != nil {
+		if err := copyTruncate(r.path, backup); err != nil {
+			return err
+		}
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.prune()
+	return nil
+}
+
+// copyTruncate copies path to backup and empties path, without renaming or reopening it elsewhere
+func copyTruncate(path string, backup string) error {
+	src, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return src.Truncate(0)
+}
+
+// prune removes rotated files beyond maxBackups, oldest first, and those older than maxAge.
+// Only files named like a rotation of this log are touched, whatever else is in the directory.
+func (r *rotatingFile) prune() {
+	backups := r.backups()
+	// the timestamp in the name sorts chronologically
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for i, backup := range backups {
+		expired := false
+		if r.maxAge > 0 {
+			if info, err := os.Stat(backup); err == nil && time.Since(info.ModTime()) > r.maxAge {
+				expired = true
+			}
+		}
+		if expired || r.maxBackups > 0 && i >= r.maxBackups {
+			os.Remove(backup)
+		}
+	}
+}
+
+// backups lists the rotated files of the log, <name>-<backupTime><ext> next to it
+func (r *rotatingFile) backups() []string {
+	dir, name := filepath.Split(r.path)
+	ext := filepath.Ext(name)
+	prefix := strings.TrimSuffix(name, ext) + "-"
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		n := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(n, prefix) || !strings.HasSuffix(n, ext) || len(n) < len(prefix)+len(ext) {
+			continue
+		}
+		if _, err := time.Parse(backupTime, n[len(prefix):len(n)-len(ext)]); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, n))
+	}
+	return backups
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
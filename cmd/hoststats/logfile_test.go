@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hoststats.log")
+	r, err := openRotatingFile(path, 1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	first := strings.Repeat("a", 1024*1024-10) + "\n"
+	if _, err := r.Write([]byte(first)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("second line\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	backups := r.backups()
+	if len(backups) != 1 {
+		t.Fatalf("%d rotated files, want 1", len(backups))
+	}
+	if got := readFile(t, backups[0]); got != first {
+		t.Errorf("rotated file has %d bytes, want the %d written before the rotation", len(got), len(first))
+	}
+	if got := readFile(t, path); got != "second line\n" {
+		t.Errorf("log file has %q after the rotation", got)
+	}
+}
+
+// on windows the log can't be renamed while another process holds it open, it is copied and truncated instead
+func TestRotatingFileCopiesWhenRenameFails(t *testing.T) {
+	rename = func(string, string) error { return errors.New("the file is being used by another process") }
+	defer func() { rename = os.Rename }()
+
+	path := filepath.Join(t.TempDir(), "hoststats.log")
+	r, err := openRotatingFile(path, 1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// another handle on the file, like a log shipper tailing it
+	other, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	first := strings.Repeat("a", 1024*1024-10) + "\n"
+	if _, err := r.Write([]byte(first)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("second line\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	backups := r.backups()
+	if len(backups) != 1 {
+		t.Fatalf("%d rotated files, want 1", len(backups))
+	}
+	if got := readFile(t, backups[0]); got != first {
+		t.Errorf("copied file has %d bytes, want the %d written before the rotation", len(got), len(first))
+	}
+	if got := readFile(t, path); got != "second line\n" {
+		t.Errorf("log file has %q after the rotation, want it truncated before the new line", got)
+	}
+}
+
+func TestRotatingFilePrune(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hoststats.log")
+	now := time.Now()
+	var rotated []string
+	for i := 1; i <= 4; i++ {
+		name := filepath.Join(dir, "hoststats-"+now.Add(-time.Duration(i)*time.Hour).Format(backupTime)+".log")
+		rotated = append(rotated, name)
+	}
+	// named like the log but not rotations of it, pruning must leave them alone
+	unrelated := []string{
+		filepath.Join(dir, "hoststats-old.log"),
+		filepath.Join(dir, "hoststats-20240131.log"),
+		filepath.Join(dir, "hoststats-debug.log"),
+		filepath.Join(dir, "hoststats-"+now.Format(backupTime)+".log.gz"),
+	}
+	for _, name := range append(append([]string(nil), rotated...), unrelated...) {
+		if err := os.WriteFile(name, []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := now.Add(-72 * time.Hour)
+	if err := os.Chtimes(rotated[3], old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := openRotatingFile(path, 1, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var left []string
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		left = append(left, filepath.Join(dir, entry.Name()))
+	}
+	want := append([]string{path, rotated[0], rotated[1]}, unrelated...)
+	sort.Strings(left)
+	sort.Strings(want)
+	if strings.Join(left, "\n") != strings.Join(want, "\n") {
+		t.Errorf("after pruning:\n%s\nwant:\n%s", strings.Join(left, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// secrets are the passwords in use, they never show up in the log
+var secrets struct {
+	sync.RWMutex
+	values map[string]bool
+}
+
+// urlPassword matches the password of credentials embedded in a url
+var urlPassword = regexp.MustCompile(`(://[^:/@\s]*):[^@/\s]*@`)
+
+// registerSecret makes the logger redact s wherever it appears, also escaped as in the userinfo of a url
+func registerSecret(s string) {
+	if s == "" {
+		return
+	}
+	secrets.Lock()
+	defer secrets.Unlock()
+	if secrets.values == nil {
+		secrets.values = make(map[string]bool)
+	}
+	secrets.values[s] = true
+	secrets.values[escapedPassword(s)] = true
+}
+
+// escapedPassword is how s is written as the password of a url, '@' is %40 and '%' is %25
+func escapedPassword(s string) string {
+	return strings.TrimPrefix(url.UserPassword("", s).String(), ":")
+}
+
+// redact blanks the registered secrets and url passwords in s
+func redact(s string) string {
+	s = urlPassword.ReplaceAllString(s, "$1:xxxxx@")
+
+	secrets.RLock()
+	values := make([]string, 0, len(secrets.values))
+	for secret := range secrets.values {
+		values = append(values, secret)
+	}
+	secrets.RUnlock()
+	// longest first, a secret containing a shorter one would otherwise be left partly in the clear
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, secret := range values {
+		s = strings.ReplaceAll(s, secret, "xxxxx")
+	}
+	return s
+}
+
+// redactURL returns u for logging, without its password
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.Redacted()
+}
+
+// redactAttr keeps credentials out of every log line, whatever the message or attribute they are in
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case *url.URL:
+			a.Value = slog.StringValue(redact(redactURL(v)))
+		case error:
+			a.Value = slog.StringValue(redact(v.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(redact(v.String()))
+		}
+	}
+	return a
+}
+
+// setupLogging makes the default slog logger write to w at level, as "text" or "json".
+// Everything diagnostic goes through it, stdout only carries data like -count and -list-vcenters.
+func setupLogging(w io.Writer, level string, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q, use debug, info, warn or error", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q, use text or json", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// logger returns a logger carrying the vcenter's worker and hostname
+func (vcenter *VCenter) logger() *slog.Logger {
+	return slog.With("worker", vcenter.Worker, "vcenter", vcenter.Hostname)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	gomail "gopkg.in/gomail.v2"
+)
+
+// mailTimeout bounds sending a mail when ctx has no earlier deadline
+const mailTimeout = time.Minute
+
+// sendMail sends m with the Mail settings. gomail's own dialer only bounds the connect, so the
+// SMTP exchange is done here on a connection whose deadline is that of ctx, a server that stops
+// answering can't hold up the end of a run. Port 465 is implicit TLS, other ports use STARTTLS
+// when the server offers it, as gomail does.
+func (config Configuration) sendMail(ctx context.Context, m *gomail.Message) error {
+	settings := config.Mail
+	if settings == nil {
+		return fmt.Errorf("no Mail settings")
+	}
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	// a shutdown cancels ctx before its deadline, that ends the exchange too
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	tlsConfig := &tls.Config{ServerName: settings.Host}
+	if settings.Port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	c, err := smtp.NewClient(conn, settings.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && settings.Port != 465 {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(address(settings.From)); err != nil {
+		return err
+	}
+	recipients, err := mail.ParseAddressList(settings.To)
+	if err != nil {
+		return fmt.Errorf("invalid To %q: %v", settings.To, err)
+	}
+	for _, to := range recipients {
+		if err := c.Rcpt(to.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := m.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// address is the bare address of a From like "hostStats <hoststats@example.com>"
+func address(from string) string {
+	if a, err := mail.ParseAddress(from); err == nil {
+		return a.Address
+	}
+	return from
+}
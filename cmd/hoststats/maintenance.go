@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// enteringMaintenance returns the hosts, by moref value, with a queued or running enter maintenance mode task.
+// The recent tasks of all hosts are looked up in one call.
+func enteringMaintenance(ctx context.Context, pc *property.Collector, hss []mo.HostSystem) (map[string]bool, error) {
+	entering := make(map[string]bool)
+
+	var refs []types.ManagedObjectReference
+	for _, hs := range hss {
+		refs = append(refs, hs.RecentTask...)
+	}
+	if len(refs) == 0 {
+		return entering, nil
+	}
+
+	var tasks []mo.Task
+	if err := pc.Retrieve(ctx, refs, []string{"info"}, &tasks); err != nil {
+		return nil, err
+	}
+	for _, task := range tasks {
+		info := task.Info
+		if info.DescriptionId != "HostSystem.enterMaintenanceMode" || info.Entity == nil {
+			continue
+		}
+		if info.State == types.TaskInfoStateQueued || info.State == types.TaskInfoStateRunning {
+			entering[info.Entity.Value] = true
+		}
+	}
+
+	return entering, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	writers "github.com/BilboTheGreedy/hostStats/output"
+)
+
+// collectedColumn is added by -merge in front of the columns, when the hosts of an input were collected
+const collectedColumn = "Collected"
+
+// mergeOutputs combines the csv outputs of several runs, separated by comma, into path without collecting.
+// Every input has to have the same columns, a host is written once per collection time, the first input listing it wins.
+func mergeOutputs(path string, inputs []string, comma string, force bool) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("no csv outputs to merge, give them after the flags")
+	}
+	// the configuration isn't read for a merge, the separator is checked like the Comma of a csv output
+	options, err := json.Marshal(map[string]string{"Comma": comma})
+	if err != nil {
+		return err
+	}
+	separator, err := writers.CSVComma(options)
+	if err != nil {
+		return fmt.Errorf("-merge-comma: %v", err)
+	}
+	if path != stdout && !force && !slices.Contains(inputs, path) {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists, use -force to replace it", path)
+		}
+	}
+
+	var headers []string
+	var rows [][]string
+	seen := make(map[string]bool)
+	for _, input := range inputs {
+		columns, records, err := readMergeInput(input, separator)
+		if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+		if headers == nil {
+			headers = columns
+		} else if !slices.Equal(headers, columns) {
+			return fmt.Errorf("%s: the columns don't match those of %s", input, inputs[0])
+		}
+
+		vcenter, host := slices.Index(columns, "VCenter"), slices.Index(columns, "Host")
+		if vcenter < 0 || host < 0 {
+			return fmt.Errorf("%s: the VCenter and Host columns are needed to match hosts", input)
+		}
+		added := 0
+		for _, record := range records {
+			key := hostKey(record[vcenter], record[host]) + "@" + record[0]
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			rows = append(rows, record)
+			added++
+		}
+		slog.Info("merged output", "phase", "merge", "path", input, "hosts", added, "duplicates", len(records)-added)
+	}
+	return csvExport(headers, rows, path, options)
+}
+
+// readMergeInput reads a csv output with the Collected column first, taken from the modification time
+// of the file unless it is the result of an earlier merge and already has one
+func readMergeInput(path string, comma rune) ([]string, [][]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, records, err := readCSV(b, comma)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(columns) > 0 && columns[0] == collectedColumn {
+		return columns, records, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	collected := info.ModTime().UTC().Format(time.RFC3339)
+	rows := make([][]string, len(records))
+	for i, record := range records {
+		rows[i] = append([]string{collected}, record...)
+	}
+	return append([]string{collectedColumn}, columns...), rows, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// outputs written with a Comma are merged with -merge-comma, the merged file keeps it
+func TestMergeComma(t *testing.T) {
+	dir := t.TempDir()
+	mon, tue := filepath.Join(dir, "mon.csv"), filepath.Join(dir, "tue.csv")
+	for _, input := range []string{mon, tue} {
+		if err := os.WriteFile(input, []byte("VCenter;Host;Cluster\nvc1;esx1;a,b\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "week.csv")
+	if err := mergeOutputs(path, []string{mon, tue}, ";", false); err != nil {
+		t.Fatal(err)
+	}
+	header, rows, err := readCSV([]byte(readFile(t, path)), ';')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(header, ",") != "Collected,VCenter,Host,Cluster" || len(rows) != 1 || rows[0][3] != "a,b" {
+		t.Errorf("merged %v with rows %v, want the host once with its cluster", header, rows)
+	}
+
+	// read with the default separator the inputs have a single column
+	if err := mergeOutputs(filepath.Join(dir, "other.csv"), []string{mon}, ",", false); err == nil {
+		t.Error("inputs merged with the wrong separator")
+	}
+	if err := mergeOutputs(filepath.Join(dir, "other.csv"), []string{mon}, ";;", false); err == nil || !strings.Contains(err.Error(), "-merge-comma") {
+		t.Errorf("error %v, want -merge-comma rejected", err)
+	}
+}
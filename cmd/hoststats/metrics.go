@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// callCounter counts the requests sent to a vcenter, soap and REST alike as they share the transport
+type callCounter struct {
+	next  http.RoundTripper
+	count int64
+}
+
+// countCalls wraps the soap client's transport, outside the limiter so waiting requests are counted too
+func (vcenter *VCenter) countCalls(client *soap.Client) {
+	vcenter.calls = &callCounter{next: client.Transport}
+	client.Transport = vcenter.calls
+}
+
+func (c *callCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&c.count, 1)
+	return c.next.RoundTrip(req)
+}
+
+// take returns the requests counted since the last take
+func (c *callCounter) take() int64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.SwapInt64(&c.count, 0)
+}
+
+// writtenRows records how many rows each output got, outputs are written one after the other,
+// and why mailing the results failed
+type writtenRows struct {
+	outputs []outputSummary
+	mailErr error
+}
+
+func (w *writtenRows) mailFailed(err error) {
+	if w != nil {
+		w.mailErr = err
+	}
+}
+
+func (w *writtenRows) add(output string, rows int) {
+	if w == nil {
+		return
+	}
+	w.outputs = append(w.outputs, outputSummary{Output: output, Rows: rows})
+}
+
+// collectorMetrics are the counters kept across daemon cycles for /metrics
+type collectorMetrics struct {
+	runs     int64
+	failures int64
+	calls    map[string]int64
+	last     *runSummary
+}
+
+func (m *collectorMetrics) update(summary runSummary) {
+	m.runs++
+	if summary.ExitCode != 0 {
+		m.failures++
+	}
+	if m.calls == nil {
+		m.calls = make(map[string]int64)
+	}
+	for _, s := range summary.VCenters {
+		m.calls[s.Hostname] += s.APICalls
+	}
+	m.last = &summary
+}
+
+// labelEscaper escapes prometheus label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// write renders the metrics in the prometheus text format
+func (m *collectorMetrics) write(w io.Writer) {
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	label := func(name, value string) string {
+		return fmt.Sprintf(`{%s="%s"}`, name, labelEscaper.Replace(value))
+	}
+
+	metric("hoststats_collector_runs_total", "counter", "Collection cycles finished.")
+	fmt.Fprintf(w, "hoststats_collector_runs_total %d\n", m.runs)
+	metric("hoststats_collector_failed_runs_total", "counter", "Collection cycles that exited with a non-zero code.")
+	fmt.Fprintf(w, "hoststats_collector_failed_runs_total %d\n", m.failures)
+
+	hostnames := make([]string, 0, len(m.calls))
+	for hostname := range m.calls {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+	metric("hoststats_collector_api_requests_total", "counter", "Requests sent to the vcenter API.")
+	for _, hostname := range hostnames {
+		fmt.Fprintf(w, "hoststats_collector_api_requests_total%s %d\n", label("vcenter", hostname), m.calls[hostname])
+	}
+
+	metric("hoststats_collector_name_cache_hits_total", "counter", "Cluster names found in the name cache.")
+	fmt.Fprintf(w, "hoststats_collector_name_cache_hits_total %d\n", atomic.LoadInt64(&nameCacheHits))
+	metric("hoststats_collector_name_cache_misses_total", "counter", "Cluster names looked up because they were not in the name cache.")
+	fmt.Fprintf(w, "hoststats_collector_name_cache_misses_total %d\n", atomic.LoadInt64(&nameCacheMisses))
+
+	if m.last == nil {
+		return
+	}
+	last := m.last
+	metric("hoststats_collector_last_run_duration_seconds", "gauge", "Duration of the last cycle.")
+	fmt.Fprintf(w, "hoststats_collector_last_run_duration_seconds %g\n", last.elapsed.Seconds())
+	metric("hoststats_collector_last_run_exit_code", "gauge", "Exit code of the last cycle.")
+	fmt.Fprintf(w, "hoststats_collector_last_run_exit_code %d\n", last.ExitCode)
+	metric("hoststats_collector_last_run_timestamp_seconds", "gauge", "Start of the last cycle as a unix timestamp.")
+	fmt.Fprintf(w, "hoststats_collector_last_run_timestamp_seconds %d\n", last.Start.Unix())
+
+	metric("hoststats_collector_connect_duration_seconds", "gauge", "Time spent connecting and logging in to the vcenter in the last cycle.")
+	for _, s := range last.VCenters {
+		fmt.Fprintf(w, "hoststats_collector_connect_duration_seconds%s %g\n", label("vcenter", s.Hostname), s.connect.Seconds())
+	}
+	metric("hoststats_collector_retrieve_duration_seconds", "gauge", "Time spent retrieving the hosts of the vcenter in the last cycle.")
+	for _, s := range last.VCenters {
+		fmt.Fprintf(w, "hoststats_collector_retrieve_duration_seconds%s %g\n", label("vcenter", s.Hostname), s.collect.Seconds())
+	}
+	metric("hoststats_collector_lookup_duration_seconds", "gauge", "Time spent looking up the cluster names of the hosts in the last cycle.")
+	for _, s := range last.VCenters {
+		fmt.Fprintf(w, "hoststats_collector_lookup_duration_seconds%s %g\n", label("vcenter", s.Hostname), s.lookup.Seconds())
+	}
+	metric("hoststats_collector_hosts", "gauge", "Hosts retrieved from the vcenter in the last cycle.")
+	for _, s := range last.VCenters {
+		fmt.Fprintf(w, "hoststats_collector_hosts%s %d\n", label("vcenter", s.Hostname), s.Hosts)
+	}
+	metric("hoststats_collector_vcenter_up", "gauge", "Whether the vcenter was collected in the last cycle.")
+	for _, s := range last.VCenters {
+		up := 0
+		if s.Status == "ok" {
+			up = 1
+		}
+		fmt.Fprintf(w, "hoststats_collector_vcenter_up%s %d\n", label("vcenter", s.Hostname), up)
+	}
+	metric("hoststats_collector_rows_written", "gauge", "Rows written to the output in the last cycle.")
+	for _, o := range last.Outputs {
+		fmt.Fprintf(w, "hoststats_collector_rows_written%s %d\n", label("output", o.Output), o.Rows)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// nicTypeEnabled reports whether a vmkernel nic of the host is enabled for nicType, like vMotion or FT logging.
+// Hosts without a virtual nic manager config fall back to the vmotion config of the network info.
+func nicTypeEnabled(hs mo.HostSystem, nicType types.HostVirtualNicManagerNicType) bool {
+	if hs.Config == nil {
+		return false
+	}
+	if info := hs.Config.VirtualNicManagerInfo; info != nil {
+		for _, netConfig := range info.NetConfig {
+			if netConfig.NicType == string(nicType) && len(netConfig.SelectedVnic) > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	if nicType != types.HostVirtualNicManagerNicTypeVmotion || hs.Config.Vmotion == nil || hs.Config.Vmotion.NetConfig == nil {
+		return false
+	}
+	selected := hs.Config.Vmotion.NetConfig.SelectedVnic
+	if selected == "" || hs.Config.Network == nil {
+		return false
+	}
+	for _, vnic := range hs.Config.Network.Vnic {
+		if vnic.Key == selected {
+			return true
+		}
+	}
+	return false
+}
+
+// ftSupported reports whether the host's hardware supports fault tolerance
+func ftSupported(hs mo.HostSystem) bool {
+	return hs.Capability != nil && hs.Capability.FtSupported != nil && *hs.Capability.FtSupported
+}
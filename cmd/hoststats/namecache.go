@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BilboTheGreedy/hostStats/collector"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// defaultNameCacheTTL is how long the shared cache keeps a name when NameCacheTTL isn't set
+const defaultNameCacheTTL = time.Hour
+
+// nameCacheHits and nameCacheMisses count the name lookups of all caches, for /metrics
+var nameCacheHits, nameCacheMisses int64
+
+// nameCache maps the references of clusters to their name and DRS settings, keyed by vcenter as references
+// are only unique within one. It is safe for the workers to share.
+type nameCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	names map[string]cachedName
+}
+
+type cachedName struct {
+	cluster collector.Cluster
+	expires time.Time
+}
+
+// sharedNames is the cache kept across workers and daemon cycles with SharedNameCache
+var sharedNames = newNameCache(0)
+
+// newNameCache returns a cache whose names expire after ttl, never when it is 0
+func newNameCache(ttl time.Duration) *nameCache {
+	return &nameCache{ttl: ttl, names: make(map[string]cachedName)}
+}
+
+// names is the cache for a collection from one vcenter: the shared one with SharedNameCache,
+// otherwise a new one so each parent is looked up once per collection
+func (config Configuration) names() *nameCache {
+	if !config.SharedNameCache {
+		return newNameCache(0)
+	}
+	ttl := time.Duration(config.NameCacheTTL)
+	if ttl <= 0 {
+		ttl = defaultNameCacheTTL
+	}
+	sharedNames.mu.Lock()
+	sharedNames.ttl = ttl
+	sharedNames.mu.Unlock()
+	return sharedNames
+}
+
+func nameKey(vcenter string, ref types.ManagedObjectReference) string {
+	return vcenter + "/" + ref.Type + ":" + ref.Value
+}
+
+// lookup returns the cached cluster of ref on vcenter
+func (c *nameCache) lookup(vcenter string, ref types.ManagedObjectReference) (collector.Cluster, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.names[nameKey(vcenter, ref)]
+	if ok && !cached.expires.IsZero() && time.Now().After(cached.expires) {
+		delete(c.names, nameKey(vcenter, ref))
+		ok = false
+	}
+	if ok {
+		atomic.AddInt64(&nameCacheHits, 1)
+	} else {
+		atomic.AddInt64(&nameCacheMisses, 1)
+	}
+	return cached.cluster, ok
+}
+
+func (c *nameCache) store(vcenter string, ref types.ManagedObjectReference, cluster collector.Cluster) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached := cachedName{cluster: cluster}
+	if c.ttl > 0 {
+		cached.expires = time.Now().Add(c.ttl)
+	}
+	c.names[nameKey(vcenter, ref)] = cached
+}
+
+// vcenterNames is the part of a nameCache for one vcenter, the cluster cache of its collection
+type vcenterNames struct {
+	cache   *nameCache
+	vcenter string
+}
+
+func (n vcenterNames) Cluster(ref types.ManagedObjectReference) (collector.Cluster, bool) {
+	return n.cache.lookup(n.vcenter, ref)
+}
+
+func (n vcenterNames) StoreCluster(ref types.ManagedObjectReference, cluster collector.Cluster) {
+	n.cache.store(n.vcenter, ref, cluster)
+}
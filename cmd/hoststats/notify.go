@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+	gomail "gopkg.in/gomail.v2"
+)
+
+// notifyTimeout bounds each webhook call
+const notifyTimeout = 30 * time.Second
+
+// changeNotice is the body posted to Webhooks when the inventory changed
+type changeNotice struct {
+	Time    time.Time
+	Changes []hostChange
+}
+
+// notifyChanges sends the inventory changes to Notify
+func (config Configuration) notifyChanges(ctx context.Context, changes []hostChange) {
+	config.notify(ctx, config.Notify, changeNotice{Time: time.Now(), Changes: changes}, changesText(changes))
+}
+
+// notify posts body to the Webhooks of n and sends text to its Slack and by mail.
+// Failures are logged and don't fail the run.
+func (config Configuration) notify(ctx context.Context, n *settings.Notify, body interface{}, text string) {
+	if n == nil {
+		return
+	}
+	for _, url := range n.Webhooks {
+		if err := postJSON(ctx, url, body); err != nil {
+			slog.Error("could not call webhook", "phase", "notify", "url", webhookHost(url), "error", err)
+		} else {
+			slog.Info("webhook called", "phase", "notify", "url", webhookHost(url))
+		}
+	}
+	if n.Slack != "" {
+		if err := postJSON(ctx, n.Slack, map[string]string{"text": text}); err != nil {
+			slog.Error("could not notify slack", "phase", "notify", "error", err)
+		} else {
+			slog.Info("slack notified", "phase", "notify")
+		}
+	}
+	if n.Mail {
+		if err := config.mailText(ctx, text); err != nil {
+			slog.Error("could not send mail", "phase", "notify", "error", err)
+		} else {
+			slog.Info("mail sent", "phase", "notify", "to", config.Mail.To)
+		}
+	}
+}
+
+// mailText mails text with the Mail settings, its first line is the subject
+func (config Configuration) mailText(ctx context.Context, text string) error {
+	if config.Mail == nil {
+		return fmt.Errorf("no Mail settings")
+	}
+	subject := strings.SplitN(text, "\n", 2)[0]
+	m := gomail.NewMessage()
+	m.SetHeader("From", config.Mail.From)
+	m.SetHeader("To", config.Mail.To)
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/plain", text)
+	return config.sendMail(ctx, m)
+}
+
+func changesText(changes []hostChange) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "hostStats: %d inventory changes", len(changes))
+	for _, c := range changes {
+		switch c.Change {
+		case "changed":
+			fmt.Fprintf(&b, "\n• %s on %s: %s %s → %s", c.Host, c.VCenter, c.Field, c.Old, c.New)
+		default:
+			fmt.Fprintf(&b, "\n• %s on %s: %s", c.Host, c.VCenter, c.Change)
+		}
+	}
+	return b.String()
+}
+
+// postJSON posts body to url and fails on anything but a 2xx response
+func postJSON(ctx context.Context, url string, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// webhookHost drops the path and query of url for logging, webhook urls carry their secret there
+func webhookHost(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		if j := strings.IndexByte(url[i+3:], '/'); j >= 0 {
+			return url[:i+3+j]
+		}
+	}
+	return url
+}
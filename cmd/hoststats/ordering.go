@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// prepareSort resolves SortBy like the metric of an alert rule, so the relative metrics like
+// FreeMemoryPercent can be sorted on as well as the numeric columns
+func (config *Configuration) prepareSort() error {
+	if config.SortBy == "" {
+		return nil
+	}
+	metric, ok := metricName(config.SortBy)
+	if !ok || metric == "Hosts" {
+		return fmt.Errorf("%q is not a numeric column or one of FreeCPUPercent, FreeMemoryPercent and FreeMemoryGB", config.SortBy)
+	}
+	config.sortMetric = metric
+	return nil
+}
+
+// sortHosts orders the hosts by vcenter, datacenter, cluster and host name, moving their rows along, so an unchanged
+// environment gives the same outputs on every run whatever order vcenter returned the hosts in. SortBy puts its
+// metric first, ascending unless SortDesc, the names then order the hosts with the same value.
+// It keeps the order of collection with -no-sort.
+func (config Configuration) sortHosts(stats []hostStat, rows [][]string) ([]hostStat, [][]string) {
+	if config.noSort || len(stats) != len(rows) {
+		return stats, rows
+	}
+
+	order := make([]int, len(stats))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := stats[order[i]], stats[order[j]]
+		if config.sortMetric != "" {
+			x, y := metricValue(a, config.sortMetric, 1), metricValue(b, config.sortMetric, 1)
+			if x != y {
+				if config.SortDesc {
+					return x > y
+				}
+				return x < y
+			}
+		}
+		switch {
+		case a.VCenter != b.VCenter:
+			return a.VCenter < b.VCenter
+		case a.Datacenter != b.Datacenter:
+			return a.Datacenter < b.Datacenter
+		case a.Cluster != b.Cluster:
+			return a.Cluster < b.Cluster
+		case a.Host != b.Host:
+			return a.Host < b.Host
+		}
+		return a.MoRef < b.MoRef
+	})
+
+	sortedStats := make([]hostStat, len(stats))
+	sortedRows := make([][]string, len(rows))
+	for i, n := range order {
+		sortedStats[i] = stats[n]
+		sortedRows[i] = rows[n]
+	}
+	return sortedStats, sortedRows
+}
+
+// sortSwitches orders the switches by host and switch name
+func (config Configuration) sortSwitches(switches []switchStat) {
+	if config.noSort {
+		return
+	}
+	sort.SliceStable(switches, func(i, j int) bool {
+		if switches[i].Host != switches[j].Host {
+			return switches[i].Host < switches[j].Host
+		}
+		return switches[i].Switch < switches[j].Switch
+	})
+}
+
+// sortCPUFeatures orders the CPUID levels by host and level
+func (config Configuration) sortCPUFeatures(features []cpuFeatureStat) {
+	if config.noSort {
+		return
+	}
+	sort.SliceStable(features, func(i, j int) bool {
+		if features[i].Host != features[j].Host {
+			return features[i].Host < features[j].Host
+		}
+		return features[i].Level < features[j].Level
+	})
+}
+
+// sortClusters orders the clusters by vcenter and cluster name
+func (config Configuration) sortClusters(clusters []clusterStat) {
+	if config.noSort {
+		return
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if clusters[i].VCenter != clusters[j].VCenter {
+			return clusters[i].VCenter < clusters[j].VCenter
+		}
+		return clusters[i].Cluster < clusters[j].Cluster
+	})
+}
+
+// sortHBAs orders the host bus adapters by host and device
+func (config Configuration) sortHBAs(hbas []hbaStat) {
+	if config.noSort {
+		return
+	}
+	sort.SliceStable(hbas, func(i, j int) bool {
+		if hbas[i].Host != hbas[j].Host {
+			return hbas[i].Host < hbas[j].Host
+		}
+		return hbas[i].Device < hbas[j].Device
+	})
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stdout is the output path that writes to standard output instead of a file
+const stdout = "-"
+
+// checkStdout allows one output on stdout and rejects the settings that name a file after it
+func (config Configuration) checkStdout() error {
+	n := 0
+	for _, o := range config.outputs {
+		if o.Path != stdout || o.Format == "kafka" {
+			continue
+		}
+		n++
+		if config.ErrorReport && o.Format == "csv" {
+			return fmt.Errorf("ErrorReport writes a file next to csv outputs, it can't be used with an output on stdout")
+		}
+		if config.validateSchema {
+			return fmt.Errorf("-validate-schema reads the outputs back, it can't be used with an output on stdout")
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("only one output can be written to stdout")
+	}
+	if config.Outpath != stdout {
+		return nil
+	}
+	switch {
+	case config.Lock && config.LockFile == "":
+		return fmt.Errorf("Lock needs a LockFile when Outpath is %s", stdout)
+	case config.WriteSummary:
+		return fmt.Errorf("WriteSummary needs Outpath to be a file")
+	case config.MailResult:
+		return fmt.Errorf("MailResult needs Outpath to be a file to attach")
+	case config.diff != "":
+		return fmt.Errorf("-diff needs Outpath to be a file")
+	case config.delta == "auto":
+		return fmt.Errorf("-delta auto needs Outpath to be a file, name the previous output instead")
+	}
+	return nil
+}
+
+// writeOutput writes an output file through replaceWith, or to stdout when path is stdout
+func writeOutput(path string, write func(io.Writer) error) error {
+	if path == stdout {
+		return write(os.Stdout)
+	}
+	return replaceWith(path, outputMode, write)
+}
+
+// timeTokens are the strftime-like tokens output paths can contain, as Go time layouts
+var timeTokens = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'H': "15",
+	'M': "04",
+	'S': "05",
+	'j': "002",
+	'b': "Jan",
+	'a': "Mon",
+	'z': "-0700",
+}
+
+// expandTime replaces the time tokens in path with t, %% is a literal %
+func expandTime(path string, t time.Time) (string, error) {
+	if !strings.Contains(path, "%") {
+		return path, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] != '%' {
+			b.WriteByte(path[i])
+			continue
+		}
+		i++
+		if i == len(path) {
+			return "", fmt.Errorf("%s: trailing %%", path)
+		}
+		if path[i] == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		layout, ok := timeTokens[path[i]]
+		if !ok {
+			return "", fmt.Errorf("%s: unknown time token %%%c", path, path[i])
+		}
+		b.WriteString(t.Format(layout))
+	}
+	return b.String(), nil
+}
+
+// checkOutpaths validates the time tokens of all output paths
+func (config Configuration) checkOutpaths() error {
+	paths := []string{config.SwitchOutpath, config.CpuFeatureOutpath, config.ClusterOutpath, config.HbaOutpath, config.AlertOutpath}
+	for _, o := range config.outputs {
+		paths = append(paths, o.Path)
+	}
+	for _, path := range paths {
+		if _, err := expandTime(path, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameOutputs applies rename to the path of every output file
+func (config *Configuration) renameOutputs(rename func(string) string) {
+	config.Outpath = rename(config.Outpath)
+	config.SwitchOutpath = rename(config.SwitchOutpath)
+	config.CpuFeatureOutpath = rename(config.CpuFeatureOutpath)
+	config.ClusterOutpath = rename(config.ClusterOutpath)
+	config.HbaOutpath = rename(config.HbaOutpath)
+	config.AlertOutpath = rename(config.AlertOutpath)
+	outputs := make([]*output, len(config.outputs))
+	for i, o := range config.outputs {
+		renamed := *o
+		renamed.Path = rename(o.Path)
+		outputs[i] = &renamed
+	}
+	config.outputs = outputs
+}
+
+// expandOutpaths fills in the time tokens of the output paths with the run's time
+func (config *Configuration) expandOutpaths(t time.Time) {
+	config.renameOutputs(func(path string) string {
+		expanded, err := expandTime(path, t)
+		if err != nil {
+			// checked by prepare
+			return path
+		}
+		return expanded
+	})
+}
+
+// stampOutputs puts the time into the name of every output file, before the extension
+func (config *Configuration) stampOutputs(t time.Time) {
+	config.renameOutputs(func(path string) string {
+		if path == "" || path == stdout {
+			return path
+		}
+		ext := filepath.Ext(path)
+		return strings.TrimSuffix(path, ext) + "-" + t.Format("20060102-150405") + ext
+	})
+}
+
+// claimedOutputs are the files this process already checked, a daemon may overwrite what its earlier cycles wrote
+var claimedOutputs sync.Map
+
+// outputFiles are the paths of all files the run writes, some may be empty
+func (config Configuration) outputFiles() []string {
+	paths := []string{config.SwitchOutpath, config.CpuFeatureOutpath, config.ClusterOutpath, config.HbaOutpath, config.AlertOutpath}
+	for _, o := range config.outputs {
+		if o.Format == "kafka" || o.Path == stdout {
+			continue
+		}
+		paths = append(paths, o.Path)
+		if config.ErrorReport && o.Format == "csv" {
+			paths = append(paths, errorsPath(o.Path))
+		}
+	}
+	if config.WriteSummary {
+		paths = append(paths, config.summaryPath())
+	}
+	if config.diff != "" {
+		paths = append(paths, config.diffPath())
+	}
+	return paths
+}
+
+// checkOutputDirs fails when the directory of an output file doesn't exist or can't be written,
+// so the run stops before connecting to any vcenter instead of after collecting
+func (config Configuration) checkOutputDirs() error {
+	if config.countOnly {
+		return nil
+	}
+
+	checked := make(map[string]bool)
+	for _, path := range config.outputFiles() {
+		if path == "" {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if checked[dir] {
+			continue
+		}
+		checked[dir] = true
+
+		info, err := os.Stat(dir)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("directory %s of %s does not exist", dir, path)
+		} else if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s of %s is not a directory", dir, path)
+		}
+		probe, err := os.CreateTemp(dir, ".hostStats-*")
+		if err != nil {
+			return fmt.Errorf("directory %s of %s is not writable: %v", dir, path, err)
+		}
+		probe.Close()
+		os.Remove(probe.Name())
+	}
+	return nil
+}
+
+// checkOverwrite fails when an output file of the run already exists, unless Overwrite is set
+func (config Configuration) checkOverwrite() error {
+	if config.Overwrite || config.countOnly {
+		return nil
+	}
+
+	paths := config.outputFiles()
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if _, claimed := claimedOutputs.Load(path); claimed {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists", path)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for _, path := range paths {
+		claimedOutputs.Store(path, true)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// lookupErrors are the lookups of a collection that failed. Without IncludePartialRows the first one
+// fails the vcenter, with it the collection goes on and every host gets them in its Error column.
+type lookupErrors struct {
+	include bool
+	logger  *slog.Logger
+	errs    []string
+}
+
+// fail returns err when it should fail the vcenter, nil when it was kept for the Error column
+func (l *lookupErrors) fail(err error) error {
+	if !l.include {
+		return err
+	}
+	l.logger.Warn("lookup failed, writing the hosts without it", "error", err)
+	l.errs = append(l.errs, err.Error())
+	return nil
+}
+
+// note keeps a lookup that failed without failing the vcenter, already logged by the caller
+func (l *lookupErrors) note(err error) {
+	if l.include {
+		l.errs = append(l.errs, err.Error())
+	}
+}
+
+// hostError is the Error column of a host, the failed lookups followed by what failed for the host alone
+func (l *lookupErrors) hostError(host ...string) string {
+	if !l.include {
+		return ""
+	}
+	return strings.Join(append(append([]string(nil), l.errs...), host...), "; ")
+}
+
+// recovered runs f and turns a panic in it into an error, so one malformed host doesn't end the run
+func recovered(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	f()
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+// clientPool keeps vcenter connections open between collection cycles, keyed by user and hostname.
+// A connection is checked out by connect and handed back by release, so it is never used by two workers at once.
+// A nil pool connects and disconnects every time.
+type clientPool struct {
+	mu    sync.Mutex
+	idle  map[string]*VCenter
+	close bool
+}
+
+func newClientPool() *clientPool {
+	return &clientPool{idle: make(map[string]*VCenter)}
+}
+
+func poolKey(vcenter *VCenter) string {
+	return vcenter.Username + "@" + vcenter.Hostname
+}
+
+// connect reuses an idle connection to the vcenter when its session is still valid,
+// logs in again when the session expired and opens a new connection when it is broken
+func (p *clientPool) connect(ctx context.Context, vcenter *VCenter, config Configuration) error {
+	if p == nil {
+		return vcenter.Connect(ctx, config)
+	}
+
+	p.mu.Lock()
+	pooled := p.idle[poolKey(vcenter)]
+	delete(p.idle, poolKey(vcenter))
+	p.mu.Unlock()
+
+	if pooled != nil {
+		ctx, cancel := config.connectContext(ctx)
+		defer cancel()
+		// the credentials are those of the current configuration, a password changed by a reload is used from now on
+		u, err := vcenter.credentialsURL()
+		if err != nil {
+			vcenter.logger().Warn("could not read the credentials, dropping pooled connection", "phase", "connect", "error", err)
+			pooled.Disconnect(ctx)
+			return vcenter.Connect(ctx, config)
+		}
+		client := pooled.client
+		userSession, err := client.SessionManager.UserSession(ctx)
+		switch {
+		case err == nil && userSession != nil:
+			vcenter.logger().Info("reusing connection", "phase", "connect")
+			vcenter.adopt(pooled, u)
+			return nil
+		case err == nil:
+			vcenter.logger().Info("session expired, logging in again", "phase", "connect")
+			vcenter.retries++
+			if err = vcenter.login(ctx, client, u); err == nil {
+				vcenter.adopt(pooled, u)
+				return nil
+			}
+		}
+		vcenter.logger().Warn("dropping broken connection", "phase", "connect", "error", err)
+		vcenter.retries++
+	}
+
+	return vcenter.Connect(ctx, config)
+}
+
+// release hands the connection back to the pool, after Close it disconnects instead.
+// The error is that of the vcenter's logout, nil when the connection was kept.
+func (p *clientPool) release(ctx context.Context, vcenter *VCenter) error {
+	if p == nil || vcenter.client == nil {
+		return vcenter.Disconnect(ctx)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.close {
+		return vcenter.Disconnect(ctx)
+	}
+	if previous := p.idle[poolKey(vcenter)]; previous != nil {
+		previous.Disconnect(ctx)
+	}
+	// keep only the connection, not the collected data
+	kept := &VCenter{VCenter: settings.VCenter{Hostname: vcenter.Hostname, Username: vcenter.Username}, Worker: vcenter.Worker}
+	kept.adopt(vcenter, vcenter.loginURL)
+	p.idle[poolKey(vcenter)] = kept
+	return nil
+}
+
+// prune disconnects the idle connections of vcenters no longer in vcenters, as after a reload removed them
+func (p *clientPool) prune(ctx context.Context, vcenters []*VCenter) {
+	if p == nil {
+		return
+	}
+
+	configured := make(map[string]bool, len(vcenters))
+	for _, vcenter := range vcenters {
+		configured[poolKey(vcenter)] = true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, vcenter := range p.idle {
+		if !configured[key] {
+			vcenter.logger().Info("vcenter no longer configured, disconnecting", "phase", "disconnect")
+			vcenter.Disconnect(ctx)
+			delete(p.idle, key)
+		}
+	}
+}
+
+// Close disconnects all idle connections, connections still checked out are disconnected when released
+func (p *clientPool) Close() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.close = true
+	for key, vcenter := range p.idle {
+		vcenter.Disconnect(context.Background())
+		delete(p.idle, key)
+	}
+}
+
+// adopt takes over the connection of a pooled vcenter, logged in with loginURL
+func (vcenter *VCenter) adopt(pooled *VCenter, loginURL *url.URL) {
+	vcenter.client = pooled.client
+	vcenter.loginURL = loginURL
+	vcenter.sessionFile = pooled.sessionFile
+	vcenter.keepSession = pooled.keepSession
+	vcenter.logoutTimeout = pooled.logoutTimeout
+	vcenter.calls = pooled.calls
+}
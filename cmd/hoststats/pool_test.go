@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+)
+
+// sessionCount logs in to the vcenter on the side and counts the sessions open on it, its own included
+func sessionCount(t *testing.T, vcenter *VCenter) func() int {
+	t.Helper()
+	ctx := context.Background()
+	u := &url.URL{Scheme: "https", Host: vcenter.Hostname, Path: "/sdk", User: url.UserPassword(vcenter.Username, vcenter.Password)}
+	c, err := govmomi.NewClient(ctx, u, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Logout(ctx) })
+	return func() int {
+		var m mo.SessionManager
+		if err := property.DefaultCollector(c.Client).RetrieveOne(ctx, *c.ServiceContent.SessionManager, []string{"sessionList"}, &m); err != nil {
+			t.Fatal(err)
+		}
+		return len(m.SessionList)
+	}
+}
+
+// a vcenter failing after the login is still logged out, no session is left behind
+func TestFailedCollectionLogsOut(t *testing.T) {
+	vcenter := newSimulator(t, nil)
+	sessions := sessionCount(t, vcenter)
+	baseline := sessions()
+
+	tests := []struct {
+		name   string
+		method string
+	}{
+		{"host view", "CreateContainerView"},
+		{"host retrieve", "RetrieveProperties"},
+	}
+	for _, tt := range tests {
+		summary := runCollection(t, Configuration{
+			Config: settings.Config{
+				Outpath: filepath.Join(t.TempDir(), "hosts.csv"),
+			},
+			VCenters: []*VCenter{soapProxy(t, vcenter, failCalls(tt.method, 100))},
+		})
+		if s := summary.VCenters[0]; s.Status != "failed" || s.LogoutError != "" {
+			t.Errorf("%s: vcenter %s with logout error %q, want failed and logged out", tt.name, s.Status, s.LogoutError)
+		}
+		if n := sessions(); n != baseline {
+			t.Errorf("%s: %d sessions after the run, want %d", tt.name, n, baseline)
+		}
+	}
+
+	// a logout that never gets through leaves its session, as the count shows
+	runCollection(t, Configuration{
+		Config: settings.Config{
+			Outpath:              filepath.Join(t.TempDir(), "hosts.csv"),
+			LogoutTimeoutSeconds: 1,
+		},
+		VCenters: []*VCenter{soapProxy(t, vcenter, hangCalls("Logout"))},
+	})
+	if n := sessions(); n != baseline+1 {
+		t.Errorf("%d sessions after a run without logout, want %d", n, baseline+1)
+	}
+}
+
+// preparedConfig is a configuration for vcenters as main prepares it, without flags
+func preparedConfig(t *testing.T, vcenters ...*VCenter) Configuration {
+	t.Helper()
+	config := Configuration{Config: settings.Config{Outpath: filepath.Join(t.TempDir(), "hosts.csv")}, VCenters: vcenters}
+	if err := config.prepare(options{}); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+// a pooled connection whose session expired logs in again with the password of the current configuration
+func TestPoolLogsInWithReloadedPassword(t *testing.T) {
+	var mu sync.Mutex
+	var passwords []string
+	password := regexp.MustCompile(`<password>([^<]*)</password>`)
+	vcenter := soapProxy(t, newSimulator(t, nil), func(method string, w http.ResponseWriter, r *http.Request) bool {
+		if method == "Login" {
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			if match := password.FindSubmatch(body); match != nil {
+				mu.Lock()
+				passwords = append(passwords, string(match[1]))
+				mu.Unlock()
+			}
+		}
+		return true
+	})
+	ctx := context.Background()
+	pool := newClientPool()
+	defer pool.Close()
+	config := preparedConfig(t, vcenter)
+	if err := pool.connect(ctx, vcenter, config); err != nil {
+		t.Fatal(err)
+	}
+	pool.release(ctx, vcenter)
+	// the vcenter ends the session, the pooled client keeps its cookie
+	pooled := pool.idle[poolKey(vcenter)].client
+	if err := pooled.SessionManager.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := &VCenter{VCenter: settings.VCenter{Hostname: vcenter.Hostname, Username: vcenter.Username, Password: "rotated"}}
+	if err := pool.connect(ctx, reloaded, preparedConfig(t, reloaded)); err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Disconnect(ctx)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(passwords) != 2 || passwords[1] != "rotated" {
+		t.Errorf("logged in with %v, want the rotated password second", passwords)
+	}
+	if p, _ := reloaded.loginURL.User.Password(); p != "rotated" {
+		t.Errorf("login url has password %q, want the rotated one", p)
+	}
+	if reloaded.client != pooled {
+		t.Error("new connection opened, want the pooled one logged in again")
+	}
+}
+
+// the pooled connections of vcenters a reload removed are logged out
+func TestPoolPrune(t *testing.T) {
+	vcenter := newSimulator(t, nil)
+	sessions := sessionCount(t, vcenter)
+	baseline := sessions()
+	ctx := context.Background()
+	pool := newClientPool()
+	defer pool.Close()
+
+	removed := soapProxy(t, vcenter, failCalls("", 0))
+	kept := soapProxy(t, vcenter, failCalls("", 0))
+	config := preparedConfig(t, removed, kept)
+	for _, v := range config.VCenters {
+		if err := pool.connect(ctx, v, config); err != nil {
+			t.Fatal(err)
+		}
+		pool.release(ctx, v)
+	}
+	if n := sessions(); n != baseline+2 {
+		t.Fatalf("%d sessions with two pooled connections, want %d", n, baseline+2)
+	}
+
+	pool.prune(ctx, []*VCenter{kept})
+	if n := sessions(); n != baseline+1 {
+		t.Errorf("%d sessions after pruning, want %d", n, baseline+1)
+	}
+	if _, ok := pool.idle[poolKey(kept)]; !ok || len(pool.idle) != 1 {
+		t.Errorf("%d idle connections, want only that of the kept vcenter", len(pool.idle))
+	}
+}
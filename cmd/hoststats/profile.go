@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+)
+
+// profiler writes the pprof profiles of -cpuprofile and -memprofile
+type profiler struct {
+	once    sync.Once
+	cpu     *os.File
+	memPath string
+}
+
+// profiles is stopped before every exit after the collection started, forced quits included
+var profiles *profiler
+
+// startProfiles starts the cpu profile, the heap profile is written when the profiler stops
+func startProfiles(cpuPath, memPath string) (*profiler, error) {
+	p := &profiler{memPath: memPath}
+	if cpuPath != "" {
+		file, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not create cpu profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(file); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("could not start cpu profile: %v", err)
+		}
+		p.cpu = file
+	}
+	return p, nil
+}
+
+// stop flushes the profiles, only the first call does anything
+func (p *profiler) stop() {
+	if p == nil {
+		return
+	}
+	p.once.Do(func() {
+		if p.cpu != nil {
+			pprof.StopCPUProfile()
+			if err := p.cpu.Close(); err != nil {
+				slog.Error("could not write cpu profile", "path", p.cpu.Name(), "error", err)
+			} else {
+				slog.Info("cpu profile saved", "path", p.cpu.Name())
+			}
+		}
+		if p.memPath != "" {
+			if err := writeHeapProfile(p.memPath); err != nil {
+				slog.Error("could not write memory profile", "path", p.memPath, "error", err)
+			} else {
+				slog.Info("memory profile saved", "path", p.memPath)
+			}
+		}
+	})
+}
+
+func writeHeapProfile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// collect first so the profile shows what is live, not what is waiting to be freed
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const progressWidth = 30
+
+// progressInterval is how often progress is logged when it can't be drawn
+const progressInterval = 30 * time.Second
+
+// progressEvent is sent by the workers as a vcenter moves through connecting, retrieving and done or failed.
+// Hosts and Total are the hosts retrieved so far, Total is 0 until the host list is known.
+type progressEvent struct {
+	VCenter string
+	Phase   string
+	Hosts   int
+	Total   int
+}
+
+// vcenterProgress is the latest event of an active vcenter
+type vcenterProgress struct {
+	progressEvent
+	since time.Time
+}
+
+// progress follows the events of a collection: drawn live with a line per active vcenter when
+// stdout and stderr are a terminal, logged every progressInterval otherwise
+type progress struct {
+	events chan progressEvent
+	stop   chan struct{}
+	done   chan struct{}
+
+	live     bool
+	out      io.Writer
+	total    int
+	finished int
+	hosts    int
+	active   map[string]*vcenterProgress
+	lines    int
+	start    time.Time
+}
+
+// newProgress starts following total vcenters, live drawing needs live and a terminal
+func newProgress(live bool, total int) *progress {
+	p := &progress{
+		events: make(chan progressEvent, 256),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		live:   live && isTerminal(os.Stdout) && isTerminal(os.Stderr),
+		out:    os.Stderr,
+		total:  total,
+		active: make(map[string]*vcenterProgress),
+		start:  time.Now(),
+	}
+	go p.run()
+	return p
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// send is safe to call from the workers, a nil progress drops the event
+func (p *progress) send(e progressEvent) {
+	if p == nil {
+		return
+	}
+	p.events <- e
+}
+
+// report sends the vcenter's phase to the progress of the run
+func (vcenter *VCenter) report(phase string, hosts, total int) {
+	vcenter.progress.send(progressEvent{VCenter: vcenter.DisplayName(), Phase: phase, Hosts: hosts, Total: total})
+}
+
+// finish stops following once every worker is done, the last state is drawn or logged
+func (p *progress) finish() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *progress) run() {
+	defer close(p.done)
+	interval := progressInterval
+	if p.live {
+		interval = 200 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e := <-p.events:
+			p.apply(e)
+		case <-ticker.C:
+			p.report()
+		case <-p.stop:
+			// the workers are done, what they sent is buffered
+			for len(p.events) > 0 {
+				p.apply(<-p.events)
+			}
+			p.report()
+			return
+		}
+	}
+}
+
+func (p *progress) apply(e progressEvent) {
+	switch e.Phase {
+	case "done", "failed":
+		delete(p.active, e.VCenter)
+		p.finished++
+		p.hosts += e.Hosts
+	default:
+		current, ok := p.active[e.VCenter]
+		if !ok || current.Phase != e.Phase {
+			p.active[e.VCenter] = &vcenterProgress{progressEvent: e, since: time.Now()}
+			return
+		}
+		current.progressEvent = e
+	}
+}
+
+func (p *progress) report() {
+	if p.live {
+		p.draw()
+		return
+	}
+	p.log()
+}
+
+// activeNames are the active vcenters by name
+func (p *progress) activeNames() []string {
+	names := make([]string, 0, len(p.active))
+	for name := range p.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *progress) percent() int {
+	if p.total == 0 {
+		return 100
+	}
+	return 100 * p.finished / p.total
+}
+
+// inFlight are the hosts retrieved so far by the active vcenters
+func (p *progress) inFlight() int {
+	hosts := 0
+	for _, a := range p.active {
+		hosts += a.Hosts
+	}
+	return hosts
+}
+
+func (p *progress) log() {
+	connecting, retrieving := 0, 0
+	for _, a := range p.active {
+		if a.Phase == "connecting" {
+			connecting++
+		} else {
+			retrieving++
+		}
+	}
+	slog.Info("progress", "phase", "progress", "percent", p.percent(), "done", p.finished, "vcenters", p.total,
+		"connecting", connecting, "retrieving", retrieving, "hosts", p.hosts+p.inFlight(),
+		"active", strings.Join(p.activeNames(), ","), "duration", time.Since(p.start).Round(time.Second))
+}
+
+// draw replaces the previous drawing with a line per active vcenter and the overall bar
+func (p *progress) draw() {
+	var b strings.Builder
+	if p.lines > 0 {
+		fmt.Fprintf(&b, "\033[%dA", p.lines)
+	}
+	b.WriteString("\r\033[J")
+	lines := 0
+	for _, name := range p.activeNames() {
+		a := p.active[name]
+		status := a.Phase
+		switch {
+		case a.Phase == "retrieving" && a.Total > 0:
+			status = fmt.Sprintf("retrieving %d/%d hosts", a.Hosts, a.Total)
+		case a.Phase == "retrieving":
+			status = "retrieving hosts"
+		}
+		fmt.Fprintf(&b, "  %-40s %-28s %s\n", name, status, time.Since(a.since).Round(time.Second))
+		lines++
+	}
+	filled := progressWidth
+	if p.total > 0 {
+		filled = progressWidth * p.finished / p.total
+	}
+	fmt.Fprintf(&b, "[%s%s] %3d%% %d/%d vcenters, %d hosts\n",
+		strings.Repeat("#", filled), strings.Repeat("-", progressWidth-filled),
+		p.percent(), p.finished, p.total, p.hosts+p.inFlight())
+	p.lines = lines + 1
+	io.WriteString(p.out, b.String())
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// setProxy points the soap client's transport at the vcenter's Proxy, if set.
+// Without one the transport keeps honoring HTTPS_PROXY/NO_PROXY from the environment.
+// It returns the proxy that will be used for u, or nil when connecting directly.
+func (vcenter *VCenter) setProxy(client *soap.Client, u *url.URL) (*url.URL, error) {
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unexpected transport %T", client.Transport)
+	}
+
+	if vcenter.Proxy != "" {
+		proxy, err := url.Parse(vcenter.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %v", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q, use http:// or socks5://", proxy.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if transport.Proxy == nil {
+		return nil, nil
+	}
+
+	return transport.Proxy(&http.Request{URL: u})
+}
+
+// proxyError tells apart failures reaching the proxy from failures reaching the vcenter behind it
+func proxyError(err error, proxy *url.URL) error {
+	if proxy == nil {
+		return err
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "proxyconnect" || strings.HasPrefix(opErr.Op, "socks")) {
+		return fmt.Errorf("could not connect to proxy %s: %w", proxy.Redacted(), err)
+	}
+
+	return fmt.Errorf("could not reach vcenter through proxy %s: %w", proxy.Redacted(), err)
+}
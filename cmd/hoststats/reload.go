@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// configReloader keeps the configuration used for the next collection cycle,
+// re-reading it from disk on SIGHUP. A configuration that fails to load or validate is
+// logged and the previous one is kept.
+type configReloader struct {
+	path string
+	opts options
+
+	mu     sync.Mutex
+	config Configuration
+	err    error // of the last reload, nil when it succeeded
+}
+
+func newConfigReloader(path string, opts options, config Configuration) *configReloader {
+	return &configReloader{path: path, opts: opts, config: config}
+}
+
+// watch reloads the configuration on every SIGHUP until the process exits
+func (r *configReloader) watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			if err := r.reload(); err != nil {
+				slog.Error("could not reload configuration, keeping the previous one", "path", r.path, "error", err)
+				continue
+			}
+			slog.Info("reloaded configuration, changes apply from the next collection cycle", "path", r.path)
+		}
+	}()
+}
+
+func (r *configReloader) reload() error {
+	config, err := readConfig(r.path)
+	if err == nil {
+		err = config.prepare(r.opts)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+	if err == nil {
+		r.config = config
+	}
+	return err
+}
+
+// lastError returns why the last reload failed, nil when it succeeded or there was none
+func (r *configReloader) lastError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// current returns the configuration for the next cycle, with fresh vcenter entries
+// so no collected data or session state carries over from the previous cycle.
+func (r *configReloader) current() Configuration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config := r.config
+	config.VCenters = make([]*VCenter, len(r.config.VCenters))
+	for i, vcenter := range r.config.VCenters {
+		fresh := *vcenter
+		fresh.reset()
+		config.VCenters[i] = &fresh
+	}
+	return config
+}
+
+// reset drops the connection and everything collected from the vcenter
+func (vcenter *VCenter) reset() {
+	vcenter.client = nil
+	vcenter.loginURL = nil
+	vcenter.clearResults()
+	vcenter.firstErr = nil
+	vcenter.elapsed = 0
+	vcenter.retries = 0
+	vcenter.connectTime = 0
+	vcenter.collectTime = 0
+	vcenter.calls = nil
+	vcenter.apiCalls = 0
+	vcenter.progress = nil
+}
+
+// clearResults drops what was collected from the vcenter and its error, before collecting it again
+func (vcenter *VCenter) clearResults() {
+	vcenter.hostResults = hostResults{}
+	vcenter.err = nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import "time"
+
+// hostResults is what one collection from a vcenter gathered, Data and stats hold the same hosts in the same order
+type hostResults struct {
+	Data        [][]string
+	stats       []hostStat
+	switches    []switchStat
+	cpuFeatures []cpuFeatureStat
+	clusters    []clusterStat
+	hbas        []hbaStat
+	raw         []rawHost
+	hostCount   int
+	lookupTime  time.Duration
+	// hosts left out because processing them panicked
+	skippedHosts int
+}
+
+// hosts is the number of hosts collected, counted or written
+func (r hostResults) hosts() int {
+	return len(r.Data) + r.hostCount
+}
+
+// workerResult is what a worker reports for one vcenter. The workers only send it,
+// the collection records it on the vcenter once it is received.
+type workerResult struct {
+	vcenter     *VCenter
+	collected   hostResults
+	err         error
+	logoutErr   error
+	duration    time.Duration
+	connectTime time.Duration
+	collectTime time.Duration
+	apiCalls    int64
+}
+
+// record takes the result of a worker as the vcenter's outcome, API calls add up across attempts
+func (r workerResult) record() {
+	vcenter := r.vcenter
+	vcenter.hostResults = r.collected
+	vcenter.err = r.err
+	vcenter.logoutErr = r.logoutErr
+	vcenter.elapsed = r.duration
+	vcenter.connectTime = r.connectTime
+	vcenter.collectTime = r.collectTime
+	vcenter.apiCalls += r.apiCalls
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+// every vcenter gets exactly one result, whether its worker succeeded or failed connecting or collecting
+func TestWorkerResults(t *testing.T) {
+	vcenter := newSimulator(t, nil)
+	ok1 := soapProxy(t, vcenter, failCalls("", 0))
+	ok2 := soapProxy(t, vcenter, failCalls("", 0))
+	noLogin := soapProxy(t, vcenter, failCalls("Login", 100))
+	noHosts := soapProxy(t, vcenter, failCalls("RetrieveProperties", 100))
+	path := filepath.Join(t.TempDir(), "hosts.csv")
+
+	summary := runCollection(t, Configuration{Config: settings.Config{Outpath: path}, VCenters: []*VCenter{ok1, noLogin, ok2, noHosts}})
+	if len(summary.VCenters) != 4 {
+		t.Fatalf("%d vcenters in the summary, want 4", len(summary.VCenters))
+	}
+	want := map[string]string{ok1.Hostname: "ok", ok2.Hostname: "ok", noLogin.Hostname: "failed", noHosts.Hostname: "failed"}
+	for _, s := range summary.VCenters {
+		if s.Status != want[s.Hostname] {
+			t.Errorf("vcenter %s is %s, want %s: %s", s.Hostname, s.Status, want[s.Hostname], s.Error)
+		}
+		if s.Status == "ok" && s.Hosts != 4 {
+			t.Errorf("vcenter %s has %d hosts, want 4", s.Hostname, s.Hosts)
+		}
+		delete(want, s.Hostname)
+	}
+	if len(want) != 0 {
+		t.Errorf("no result for %v", want)
+	}
+	if rows := readRows(t, path); len(rows) != 8 {
+		t.Errorf("%d rows written, want the 4 hosts of each of the 2 vcenters that succeeded", len(rows))
+	}
+}
+
+// a run cut short before the workers start still gets a result for every vcenter
+func TestWorkerResultsShutdown(t *testing.T) {
+	vcenter := newSimulator(t, nil)
+	config := Configuration{
+		Config: settings.Config{
+			Outpath: filepath.Join(t.TempDir(), "hosts.csv"),
+		},
+		VCenters: []*VCenter{soapProxy(t, vcenter, failCalls("", 0)), soapProxy(t, vcenter, failCalls("", 0))},
+	}
+	if err := config.prepare(options{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan runSummary)
+	go func() { done <- collect(ctx, config, false) }()
+	select {
+	case summary := <-done:
+		if summary.ExitCode != exitShutdown {
+			t.Errorf("exit code %d, want %d", summary.ExitCode, exitShutdown)
+		}
+		if len(summary.VCenters) != 2 {
+			t.Errorf("%d vcenters in the summary, want 2", len(summary.VCenters))
+		}
+		for _, s := range summary.VCenters {
+			if s.Status == "ok" {
+				t.Errorf("vcenter %s collected after the shutdown", s.Hostname)
+			}
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("the run did not end without results from its workers")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// retryFailed collects the vcenters that failed once more, one after the other, now that the others are done.
+// Vcenters skipped by a shutdown are not retried, nor those that failed to log in, a second try could lock the account.
+// A vcenter failing again keeps what its first attempt collected.
+func (config Configuration) retryFailed(ctx context.Context) {
+	var failed []*VCenter
+	for _, vcenter := range config.VCenters {
+		if vcenter.err == nil || errors.Is(vcenter.err, context.Canceled) || errorCategory(vcenter.err) == "auth" {
+			continue
+		}
+		failed = append(failed, vcenter)
+	}
+	if len(failed) == 0 || ctx.Err() != nil {
+		return
+	}
+
+	slog.Info("retrying failed vcenters", "phase", "retry", "vcenters", len(failed))
+	vcenters := make(chan *VCenter, len(failed))
+	results := make(chan workerResult, len(failed))
+	for _, vcenter := range failed {
+		vcenters <- vcenter
+	}
+	close(vcenters)
+	worker(ctx, 0, config, vcenters, results, nil)
+	close(results)
+
+	for result := range results {
+		vcenter := result.vcenter
+		first := vcenter.hostResults
+		vcenter.firstErr = vcenter.err
+		result.record()
+		if result.err == nil {
+			vcenter.logger().Info("recovered on retry", "phase", "retry", "hosts", result.collected.hosts())
+			continue
+		}
+		vcenter.logger().Warn("failed again on retry", "phase", "retry", "error", result.err)
+		if first.hosts() > result.collected.hosts() {
+			vcenter.hostResults = first
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	settings "github.com/BilboTheGreedy/hostStats/config"
+)
+
+// a vcenter that fails and is collected again must be written once, with the hosts of its second attempt
+func TestRetriedVCenterWrittenOnce(t *testing.T) {
+	vcenter := soapProxy(t, newSimulator(t, nil), failCalls("CreateContainerView", 1))
+	path := filepath.Join(t.TempDir(), "hosts.csv")
+
+	summary := runCollection(t, Configuration{Config: settings.Config{Outpath: path, RetryFailedAtEnd: true}, VCenters: []*VCenter{vcenter}})
+	if summary.ExitCode != 0 {
+		t.Fatalf("exit code %d, want 0", summary.ExitCode)
+	}
+	if retry := summary.VCenters[0].Retry; retry != "recovered" {
+		t.Fatalf("retry is %q, want recovered", retry)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := -1
+	for i, column := range rows[0] {
+		if column == "Host" {
+			host = i
+		}
+	}
+	seen := make(map[string]bool)
+	for _, row := range rows[1:] {
+		if seen[row[host]] {
+			t.Errorf("host %s written twice", row[host])
+		}
+		seen[row[host]] = true
+	}
+	// the vcsim vcenter model has a standalone host and a cluster of three
+	if len(seen) != 4 || summary.Rows != 4 {
+		t.Errorf("%d hosts written and %d rows in the summary, want 4", len(seen), summary.Rows)
+	}
+}
+
+// a vcenter failing part way through collecting fails on its own, the others are still written
+func TestFailingVCenterFailsAlone(t *testing.T) {
+	vcenter := newSimulator(t, nil)
+	healthy := soapProxy(t, vcenter, failCalls("", 0))
+	failing := soapProxy(t, vcenter, failCalls("RetrieveProperties", 100))
+	path := filepath.Join(t.TempDir(), "hosts.csv")
+
+	summary := runCollection(t, Configuration{Config: settings.Config{Outpath: path}, VCenters: []*VCenter{failing, healthy}})
+	if summary.ExitCode == 0 {
+		t.Error("exit code 0 with a failed vcenter")
+	}
+	status := make(map[string]vcenterSummary)
+	for _, s := range summary.VCenters {
+		status[s.Hostname] = s
+	}
+	if s := status[failing.Hostname]; s.Status != "failed" || s.Error == "" {
+		t.Errorf("failing vcenter is %s with error %q, want failed", s.Status, s.Error)
+	}
+	if s := status[healthy.Hostname]; s.Status != "ok" || s.Hosts != 4 {
+		t.Errorf("healthy vcenter is %s with %d hosts, want ok with 4", s.Status, s.Hosts)
+	}
+
+	rows := readRows(t, path)
+	if len(rows) != 4 {
+		t.Fatalf("%d rows written, want the 4 hosts of the healthy vcenter", len(rows))
+	}
+	for _, row := range rows {
+		if row["VCenter"] != healthy.Hostname {
+			t.Errorf("host %s written for vcenter %s", row["Host"], row["VCenter"])
+		}
+	}
+}
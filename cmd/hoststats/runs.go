@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultRunHistory is how many runs GET /api/runs keeps without RunHistory
+const defaultRunHistory = 20
+
+// runRecord is one collection cycle of the daemon as listed by GET /api/runs, End is unset while it runs
+type runRecord struct {
+	ID       int
+	Trigger  string
+	Start    time.Time
+	End      *time.Time `json:",omitempty"`
+	Running  bool
+	ExitCode int
+	Hosts    int
+	Rows     int
+	VCenters []vcenterSummary
+	Outputs  []outputSummary
+}
+
+// runHistory is a ring of the last runs, persisted to path after every run when it is set
+type runHistory struct {
+	mu      sync.Mutex
+	size    int
+	path    string
+	runs    []runRecord // oldest first
+	nextID  int
+	running *runRecord
+	pending bool // a run was requested through the api and hasn't started yet
+}
+
+// newRunHistory keeps size runs, earlier runs are read back from path
+func newRunHistory(config Configuration) *runHistory {
+	h := &runHistory{size: config.RunHistory, path: config.RunHistoryFile, nextID: 1}
+	if h.size <= 0 {
+		h.size = defaultRunHistory
+	}
+	if h.path == "" {
+		return h
+	}
+	b, err := os.ReadFile(h.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("could not read run history", "path", h.path, "error", err)
+		}
+		return h
+	}
+	if err := json.Unmarshal(b, &h.runs); err != nil {
+		slog.Warn("could not read run history", "path", h.path, "error", err)
+		h.runs = nil
+		return h
+	}
+	if len(h.runs) > h.size {
+		h.runs = h.runs[len(h.runs)-h.size:]
+	}
+	for _, run := range h.runs {
+		if run.ID >= h.nextID {
+			h.nextID = run.ID + 1
+		}
+	}
+	return h
+}
+
+// request marks a run as asked for through the api, it returns the id the run will get
+// or the id of the running one with ok false
+func (h *runHistory) request() (id int, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.running != nil {
+		return h.running.ID, false
+	}
+	h.pending = true
+	return h.nextID, true
+}
+
+// queue marks a run as asked for even when one is running, it starts after that one
+func (h *runHistory) queue() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pending = true
+}
+
+// started records a run starting now, a run asked for through the api is satisfied by it
+func (h *runHistory) started(start time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	trigger := "schedule"
+	if h.pending {
+		trigger = "api"
+		h.pending = false
+	}
+	h.running = &runRecord{ID: h.nextID, Trigger: trigger, Start: start, Running: true}
+	h.nextID++
+}
+
+// finished records the outcome of the running run and saves the history
+func (h *runHistory) finished(summary runSummary, end time.Time) {
+	h.mu.Lock()
+	if h.running == nil {
+		h.mu.Unlock()
+		return
+	}
+	run := *h.running
+	h.running = nil
+	run.End, run.Running = &end, false
+	run.ExitCode, run.Hosts, run.Rows = summary.ExitCode, summary.Hosts, summary.Rows
+	run.VCenters, run.Outputs = summary.VCenters, summary.Outputs
+	h.runs = append(h.runs, run)
+	if len(h.runs) > h.size {
+		h.runs = append([]runRecord(nil), h.runs[len(h.runs)-h.size:]...)
+	}
+	runs := append([]runRecord(nil), h.runs...)
+	h.mu.Unlock()
+
+	if h.path != "" {
+		if err := saveRuns(h.path, runs); err != nil {
+			slog.Error("could not save run history", "path", h.path, "error", err)
+		}
+	}
+}
+
+// list returns the runs newest first, the running one included
+func (h *runHistory) list() []runRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := make([]runRecord, 0, len(h.runs)+1)
+	if h.running != nil {
+		runs = append(runs, *h.running)
+	}
+	for i := len(h.runs) - 1; i >= 0; i-- {
+		runs = append(runs, h.runs[i])
+	}
+	return runs
+}
+
+// saveRuns replaces the history file
+func saveRuns(path string, runs []runRecord) error {
+	b, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, b)
+}
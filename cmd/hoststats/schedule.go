@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+	// windows has no zoneinfo database for Timezone to load from
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser accepts standard 5 field cron expressions, an optional leading seconds field and descriptors like @hourly
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// prepareSchedule validates Interval, Schedule and Timezone for daemon mode
+func (config *Configuration) prepareSchedule(daemon bool) error {
+	if config.Interval < 0 {
+		return fmt.Errorf("negative Interval %s", time.Duration(config.Interval))
+	}
+	if config.Interval > 0 && config.Schedule != "" {
+		return fmt.Errorf("Interval and Schedule are mutually exclusive, set only one")
+	}
+	if config.Timezone != "" && config.Schedule == "" {
+		return fmt.Errorf("Timezone only applies to Schedule")
+	}
+
+	config.schedule = nil
+	if config.Schedule != "" {
+		timezone := config.Timezone
+		if timezone == "" {
+			timezone = "UTC"
+		}
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("invalid Timezone %q: %v", config.Timezone, err)
+		}
+		schedule, err := cronParser.Parse(config.Schedule)
+		if err != nil {
+			return fmt.Errorf("invalid Schedule %q: %v", config.Schedule, err)
+		}
+		config.schedule = schedule
+		config.location = location
+	}
+
+	if daemon && config.Interval == 0 && config.schedule == nil {
+		return fmt.Errorf("daemon mode needs an Interval or a Schedule")
+	}
+	return nil
+}
+
+// nextRun returns when the cycle after one that started at start should begin
+func (config Configuration) nextRun(start time.Time) time.Time {
+	now := time.Now()
+	if config.schedule != nil {
+		if missed := config.schedule.Next(start.In(config.location)); missed.Before(now) {
+			slog.Warn("cycle was still running at a scheduled time, skipping the runs it overlapped", "missed", missed.Format(time.RFC3339))
+		}
+		return config.schedule.Next(now.In(config.location))
+	}
+
+	interval := time.Duration(config.Interval)
+	elapsed := now.Sub(start)
+	if elapsed < interval {
+		return start.Add(interval)
+	}
+	slog.Warn("cycle took longer than the interval", "duration", elapsed.Round(time.Second), "interval", interval, "skipped", int(elapsed/interval))
+	return now.Add(interval - elapsed%interval)
+}
+
+// period is the time between two cycles, for a Schedule the gap between its next two runs
+func (config Configuration) period() time.Duration {
+	if config.schedule != nil {
+		next := config.schedule.Next(time.Now().In(config.location))
+		return config.schedule.Next(next).Sub(next)
+	}
+	return time.Duration(config.Interval)
+}
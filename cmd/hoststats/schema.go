@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// hostsSchemaJSON is the agreed shape of the json output, -validate-schema checks every json output against it.
+// A field added to hostStat has to be added here too, or a non string value fails the check.
+//
+//go:embed hosts.schema.json
+var hostsSchemaJSON string
+
+var hostsSchema struct {
+	once   sync.Once
+	schema *jsonschema.Schema
+	err    error
+}
+
+// validateOutput reads back a json output and checks it against the embedded schema
+func validateOutput(path string) error {
+	hostsSchema.once.Do(func() {
+		hostsSchema.schema, hostsSchema.err = jsonschema.CompileString("hosts.schema.json", hostsSchemaJSON)
+	})
+	if hostsSchema.err != nil {
+		return hostsSchema.err
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return err
+	}
+	return hostsSchema.schema.Validate(v)
+}
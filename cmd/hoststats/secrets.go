@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// resolveSecrets fetches the password of every vcenter with a PasswordSource before any worker starts,
+// so a missing secret fails the run up front. Errors name the vcenter and secret id, never the value.
+func resolveSecrets(ctx context.Context, vcenters []*VCenter) error {
+	r := &secretResolver{aws: make(map[string]*secretsmanager.Client), azure: make(map[string]*azsecrets.Client)}
+
+	for _, vcenter := range vcenters {
+		if vcenter.PasswordSource == "" {
+			continue
+		}
+		if vcenter.PasswordSecret == "" {
+			return fmt.Errorf("vcenter %s: PasswordSource %s needs a PasswordSecret", vcenter.Hostname, vcenter.PasswordSource)
+		}
+
+		var value string
+		var err error
+		switch vcenter.PasswordSource {
+		case "aws-sm":
+			value, err = r.awsSecret(ctx, vcenter.PasswordSecret)
+		case "azure-kv":
+			value, err = r.azureSecret(ctx, vcenter.PasswordSecret)
+		default:
+			return fmt.Errorf("vcenter %s: unknown PasswordSource %q", vcenter.Hostname, vcenter.PasswordSource)
+		}
+		if err != nil {
+			return fmt.Errorf("vcenter %s: could not resolve secret %s from %s: %v", vcenter.Hostname, vcenter.PasswordSecret, vcenter.PasswordSource, err)
+		}
+
+		username, password := splitSecret(value)
+		if username != "" && vcenter.Username == "" {
+			vcenter.Username = username
+		}
+		vcenter.Password = password
+	}
+
+	return nil
+}
+
+// secretResolver reuses the clients built from the default credential chains
+type secretResolver struct {
+	awsCred   *aws.Config
+	aws       map[string]*secretsmanager.Client
+	azureCred *azidentity.DefaultAzureCredential
+	azure     map[string]*azsecrets.Client
+}
+
+// awsSecret reads a secret by name or ARN, an ARN's region takes precedence over the default one
+func (r *secretResolver) awsSecret(ctx context.Context, id string) (string, error) {
+	if r.awsCred == nil {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return "", err
+		}
+		r.awsCred = &cfg
+	}
+
+	region := r.awsCred.Region
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	client, ok := r.aws[region]
+	if !ok {
+		client = secretsmanager.NewFromConfig(*r.awsCred, func(o *secretsmanager.Options) {
+			o.Region = region
+		})
+		r.aws[region] = client
+	}
+
+	out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("secret has no string value")
+	}
+	return *out.SecretString, nil
+}
+
+// azureSecret reads a secret given by its id, https://<vault>.vault.azure.net/secrets/<name>[/<version>]
+func (r *secretResolver) azureSecret(ctx context.Context, id string) (string, error) {
+	u, err := url.Parse(id)
+	if err != nil || u.Scheme != "https" {
+		return "", fmt.Errorf("secret id must be https://<vault>.vault.azure.net/secrets/<name>")
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "secrets" {
+		return "", fmt.Errorf("secret id must be https://<vault>.vault.azure.net/secrets/<name>")
+	}
+	name, version := parts[1], ""
+	if len(parts) > 2 {
+		version = parts[2]
+	}
+
+	if r.azureCred == nil {
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return "", err
+		}
+		r.azureCred = cred
+	}
+
+	vault := "https://" + u.Host
+	client, ok := r.azure[vault]
+	if !ok {
+		client, err = azsecrets.NewClient(vault, r.azureCred, nil)
+		if err != nil {
+			return "", err
+		}
+		r.azure[vault] = client
+	}
+
+	resp, err := client.GetSecret(ctx, name, version, nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.Value == nil {
+		return "", fmt.Errorf("secret has no value")
+	}
+	return *resp.Value, nil
+}
+
+// splitSecret accepts a plain password or a JSON object with "password" and optionally "username"
+func splitSecret(value string) (string, string) {
+	var creds struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if strings.HasPrefix(strings.TrimSpace(value), "{") && json.Unmarshal([]byte(value), &creds) == nil && creds.Password != "" {
+		return creds.Username, creds.Password
+	}
+	return "", value
+}
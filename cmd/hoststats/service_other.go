@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "log/slog"
+
+func runningAsService() bool {
+	return false
+}
+
+func logToEventLog() error {
+	return nil
+}
+
+func runService(reloader *configReloader) int {
+	return 1
+}
+
+func controlService(cmd string, cfgFile string) int {
+	slog.Error("-service is only supported on windows")
+	return 1
+}
@@ -0,0 +1,189 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is the key the service and its event log source are registered under
+const serviceName = "hostStats"
+
+func runningAsService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// logToEventLog sends everything written to stdout and stderr to the windows
+// event log, lines containing ERROR or WARN are logged as errors or warnings.
+// It has to run before setupLogging so the logger picks up the new stderr.
+func logToEventLog() error {
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	os.Stdout = w
+	os.Stderr = w
+
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.Contains(line, "ERROR"):
+				elog.Error(1, line)
+			case strings.Contains(line, "WARN"):
+				elog.Warning(1, line)
+			default:
+				elog.Info(1, line)
+			}
+		}
+	}()
+	return nil
+}
+
+// hostService runs the daemon loop under the service control manager
+type hostService struct {
+	reloader *configReloader
+}
+
+func runService(reloader *configReloader) int {
+	if err := svc.Run(serviceName, &hostService{reloader: reloader}); err != nil {
+		slog.Error("service failed", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// Execute handles the service control requests. Stop lets the running cycle
+// finish and flush its outputs, Shutdown aborts it as windows is going down.
+func (h *hostService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	quit := make(chan struct{})
+	var stop sync.Once
+
+	result := make(chan int, 1)
+	go func() {
+		result <- runDaemon(ctx, h.reloader, quit)
+	}()
+
+	accepts := svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.Running, Accepts: accepts}
+	for {
+		select {
+		case code := <-result:
+			status <- svc.Status{State: svc.StopPending}
+			return code != 0, uint32(code)
+		case c := <-requests:
+			switch c.Cmd {
+			case svc.Interrogate:
+				status <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				slog.Info("service stop requested, stopping after the current cycle")
+				status <- svc.Status{State: svc.StopPending, WaitHint: 30000}
+				stop.Do(func() { close(quit) })
+				if c.Cmd == svc.Shutdown {
+					cancel()
+				}
+			}
+		}
+	}
+}
+
+// controlService installs, uninstalls, starts or stops the windows service.
+// The installed service runs this executable in daemon mode with cfgFile.
+func controlService(cmd string, cfgFile string) int {
+	m, err := mgr.Connect()
+	if err != nil {
+		slog.Error("could not connect to the service control manager", "error", err)
+		return 1
+	}
+	defer m.Disconnect()
+
+	switch cmd {
+	case "install":
+		err = installService(m, cfgFile)
+	case "uninstall":
+		err = uninstallService(m)
+	case "start", "stop":
+		var s *mgr.Service
+		s, err = m.OpenService(serviceName)
+		if err != nil {
+			break
+		}
+		defer s.Close()
+		if cmd == "start" {
+			err = s.Start()
+		} else {
+			_, err = s.Control(svc.Stop)
+		}
+	default:
+		err = fmt.Errorf("unknown command %q, use install, uninstall, start or stop", cmd)
+	}
+	if err != nil {
+		slog.Error("service command failed", "command", cmd, "service", serviceName, "error", err)
+		return 1
+	}
+	slog.Info("service command done", "command", cmd, "service", serviceName)
+	return 0
+}
+
+func installService(m *mgr.Mgr, cfgFile string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cfgFile, err = filepath.Abs(cfgFile)
+	if err != nil {
+		return err
+	}
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("already installed")
+	}
+
+	config := mgr.Config{DisplayName: name, Description: description, StartType: mgr.StartAutomatic}
+	s, err := m.CreateService(serviceName, exe, config, "-daemon", "-config", cfgFile)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("could not register the event log source: %v", err)
+	}
+	return nil
+}
+
+func uninstallService(m *mgr.Mgr) error {
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	return eventlog.Remove(serviceName)
+}
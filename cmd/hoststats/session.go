@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// cachedSession is what gets stored per vcenter in the SessionCache directory
+type cachedSession struct {
+	Cookies []*http.Cookie
+}
+
+// sessionFile returns the cache file for the vcenter's session, empty when caching is off
+func (config Configuration) sessionFile(vcenter *VCenter) string {
+	if config.SessionCache == "" {
+		return ""
+	}
+	sum := sha1.Sum([]byte(strings.ToLower(vcenter.Username + "@" + vcenter.Hostname)))
+	return filepath.Join(config.SessionCache, hex.EncodeToString(sum[:])+".json")
+}
+
+// loadSession puts the cached session cookie, if any, on the soap client before it is used
+func (vcenter *VCenter) loadSession(client *soap.Client, path string) {
+	vcenter.sessionFile = path
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var cached cachedSession
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return
+	}
+	client.Jar.SetCookies(client.URL(), cached.Cookies)
+}
+
+// resumeSession reports whether the cached session cookie is still logged in
+func (vcenter *VCenter) resumeSession(ctx context.Context, path string) bool {
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	userSession, err := vcenter.client.SessionManager.UserSession(ctx)
+	return err == nil && userSession != nil
+}
+
+// saveSession writes the session cookie of a fresh login to the cache, readable by the owner only
+func (vcenter *VCenter) saveSession(path string) error {
+	soapClient := vcenter.client.Client.Client
+	data, err := json.Marshal(cachedSession{Cookies: soapClient.Jar.Cookies(soapClient.URL())})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// forgetSession removes the cached session, it is called before logging out
+func (vcenter *VCenter) forgetSession() {
+	if vcenter.sessionFile != "" {
+		os.Remove(vcenter.sessionFile)
+	}
+}
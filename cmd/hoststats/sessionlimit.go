@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// sessionSlots caps the sessions open at once per username, over all vcenters, at MaxSessionsPerUser.
+// A worker takes a slot before connecting and gives it back once the vcenter is released, workers
+// over the limit wait for one instead of failing. A nil sessionSlots doesn't limit anything.
+type sessionSlots struct {
+	limit int
+
+	mu    sync.Mutex
+	users map[string]chan struct{}
+}
+
+func newSessionSlots(limit int) *sessionSlots {
+	if limit <= 0 {
+		return nil
+	}
+	return &sessionSlots{limit: limit, users: make(map[string]chan struct{})}
+}
+
+// acquire waits for a session slot of the vcenter's user, the returned func gives it back
+func (s *sessionSlots) acquire(ctx context.Context, vcenter *VCenter) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+
+	// usernames are matched like vcenter matches them at login, without case
+	user := strings.ToLower(vcenter.Username)
+	s.mu.Lock()
+	slots, ok := s.users[user]
+	if !ok {
+		slots = make(chan struct{}, s.limit)
+		s.users[user] = slots
+	}
+	s.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	default:
+	}
+	slog.Info("waiting for a session of the user to end", "vcenter", vcenter.Hostname, "phase", "connect", "user", vcenter.Username, "limit", s.limit)
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// exitForced is the exit code when a repeated signal forced the process to quit without cleaning up
+const exitForced = 5
+
+// cancelOnSignals cancels ctx on the first SIGINT/SIGTERM, so workers stop and the sessions are logged
+// out. The previous outputs are kept, or replaced with what was collected with KeepPartialOutput.
+// Another signal quits right away.
+func cancelOnSignals() context.Context {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-signals
+		slog.Warn("shutdown requested, stopping the collection, signal again to force quit")
+		cancel()
+		<-signals
+		forceQuit()
+	}()
+	return ctx
+}
+
+// stopOnSignals closes quit on the first SIGINT/SIGTERM, cancels ctx on the second
+// and quits right away on the third
+func stopOnSignals() (context.Context, <-chan struct{}) {
+	signals := make(chan os.Signal, 3)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	quit := make(chan struct{})
+	go func() {
+		<-signals
+		slog.Warn("shutdown requested, stopping after the current cycle")
+		close(quit)
+		<-signals
+		slog.Warn("second signal, aborting the current cycle, signal again to force quit")
+		cancel()
+		<-signals
+		forceQuit()
+	}()
+	return ctx, quit
+}
+
+func forceQuit() {
+	slog.Error("forced quit, output files and vcenter sessions may be left behind")
+	profiles.stop()
+	os.Exit(exitForced)
+}
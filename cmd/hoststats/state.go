@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// stateVersion is the format of the state file, bump it and migrate older states in loadState when stateHost changes
+const stateVersion = 1
+
+// inventoryState is the last known inventory, kept in StateFile between runs
+type inventoryState struct {
+	Version int
+	Updated time.Time
+	Hosts   map[string]stateHost
+
+	// no state file yet, the first run records the inventory without reporting it as changed
+	missing bool
+}
+
+// stateHost is what is remembered of a host, only the fields whose changes are worth a report
+type stateHost struct {
+	VCenter string
+	Host    string
+	Cluster string
+	Version string
+	Build   string
+}
+
+// loadState reads the state file, a missing file gives an empty state.
+// A file written by a newer version is refused rather than replaced, so a downgrade doesn't lose it.
+func loadState(path string) (*inventoryState, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &inventoryState{Version: stateVersion, Hosts: make(map[string]stateHost), missing: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := &inventoryState{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("could not decode: %v", err)
+	}
+	switch {
+	case state.Version < 1:
+		return nil, fmt.Errorf("no state file version")
+	case state.Version > stateVersion:
+		return nil, fmt.Errorf("state file version %d is newer than the supported version %d", state.Version, stateVersion)
+	}
+	if state.Hosts == nil {
+		state.Hosts = make(map[string]stateHost)
+	}
+	return state, nil
+}
+
+// update records the hosts of the vcenters collected in this run and returns what changed materially:
+// hosts added and removed, and hosts with a new build or in another cluster.
+// The hosts of vcenters that failed are kept as they were, they didn't disappear.
+func (state *inventoryState) update(vcenters []*VCenter) []hostChange {
+	changes := []hostChange{}
+	collected := make(map[string]bool)
+	current := make(map[string]stateHost)
+	for _, vcenter := range vcenters {
+		if vcenter.err != nil {
+			continue
+		}
+		collected[vcenter.DisplayName()] = true
+		for _, s := range vcenter.stats {
+			current[hostKey(s.VCenter, s.Host)] = stateHost{VCenter: s.VCenter, Host: s.Host, Cluster: s.Cluster, Version: s.Version, Build: s.Build}
+		}
+	}
+
+	for key, old := range state.Hosts {
+		if !collected[old.VCenter] {
+			continue
+		}
+		now, ok := current[key]
+		if !ok {
+			changes = append(changes, hostChange{Change: "removed", VCenter: old.VCenter, Host: old.Host})
+			delete(state.Hosts, key)
+			continue
+		}
+		if old.Build != now.Build {
+			changes = append(changes, hostChange{Change: "changed", VCenter: now.VCenter, Host: now.Host, Field: "Build", Old: old.Build, New: now.Build})
+		}
+		if old.Cluster != now.Cluster {
+			changes = append(changes, hostChange{Change: "changed", VCenter: now.VCenter, Host: now.Host, Field: "Cluster", Old: old.Cluster, New: now.Cluster})
+		}
+	}
+	for key, now := range current {
+		if _, ok := state.Hosts[key]; !ok {
+			changes = append(changes, hostChange{Change: "added", VCenter: now.VCenter, Host: now.Host})
+		}
+		state.Hosts[key] = now
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.VCenter != b.VCenter {
+			return a.VCenter < b.VCenter
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.Field < b.Field
+	})
+	return changes
+}
+
+// save writes the state to a temporary file first, so a crash never leaves half a state behind
+func (state *inventoryState) save(path string) error {
+	state.Version = stateVersion
+	state.Updated = time.Now()
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, b)
+}
+
+// outputMode is the permission of the output files, the state file keeps the 0600 of a temporary file
+const outputMode = 0644
+
+// replaceFile writes b to path through a temporary file renamed over it, so path is never half written
+func replaceFile(path string, b []byte) error {
+	return replaceWith(path, 0600, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+// replaceWith lets write fill a temporary file next to path and renames it over path once it is
+// complete, so readers never see half a file. When write fails path is left as it was.
+func replaceWith(path string, mode os.FileMode, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// exitPartial is the exit code when some but not all vcenters failed and FailOnPartial is on
+const exitPartial = 2
+
+// runSummary is the outcome of one run, as printed at the end and written to the summary file
+type runSummary struct {
+	Start    time.Time
+	Duration string
+	ExitCode int
+	Hosts    int
+	Rows     int
+	APICalls int64
+	// hosts left out because processing them failed
+	SkippedHosts int `json:",omitempty"`
+	// vcenters whose session could not be logged out at the end
+	LogoutFailures int `json:",omitempty"`
+	// why the results could not be mailed with MailResult
+	MailError string `json:",omitempty"`
+	VCenters  []vcenterSummary
+	Outputs   []outputSummary
+	Alerts    []alertStat `json:",omitempty"`
+
+	elapsed time.Duration
+}
+
+// collected reports whether the run produced results: it neither failed nor was stopped and at least
+// one vcenter was collected. Some vcenters failing, too few hosts or alerts firing still count.
+func (summary runSummary) collected() bool {
+	switch summary.ExitCode {
+	case 1, exitShutdown, exitForced:
+		return false
+	}
+	for _, vcenter := range summary.VCenters {
+		if vcenter.Status == "ok" {
+			return true
+		}
+	}
+	return false
+}
+
+// vcenterSummary is the outcome of one vcenter, Retry is recovered or failed for the vcenters
+// collected again with RetryFailedAtEnd and FirstError the error of their first attempt
+type vcenterSummary struct {
+	Name            string
+	Hostname        string
+	Status          string
+	Category        string `json:",omitempty"`
+	Retryable       bool   `json:",omitempty"`
+	Retry           string `json:",omitempty"`
+	FirstError      string `json:",omitempty"`
+	Error           string `json:",omitempty"`
+	LogoutError     string `json:",omitempty"`
+	Hosts           int
+	Rows            int
+	SkippedHosts    int `json:",omitempty"`
+	APICalls        int64
+	Duration        string
+	ConnectDuration string
+	CollectDuration string
+	// part of CollectDuration spent looking up the cluster names
+	LookupDuration string
+
+	connect, collect, lookup time.Duration
+}
+
+// outputSummary is how many rows an output got, kafka outputs count the messages published
+type outputSummary struct {
+	Output string
+	Rows   int
+}
+
+// summarize collects the per vcenter results of a run
+func (config Configuration) summarize(start time.Time) runSummary {
+	elapsed := time.Since(start)
+	summary := runSummary{Start: start, Duration: elapsed.Round(time.Millisecond).String(), elapsed: elapsed}
+	if config.written != nil {
+		summary.Outputs = config.written.outputs
+		if config.written.mailErr != nil {
+			summary.MailError = config.written.mailErr.Error()
+		}
+	}
+	for _, vcenter := range config.VCenters {
+		s := vcenterSummary{
+			Name:            vcenter.DisplayName(),
+			Hostname:        vcenter.Hostname,
+			Status:          "ok",
+			Hosts:           len(vcenter.stats) + vcenter.hostCount,
+			Rows:            len(vcenter.Data),
+			SkippedHosts:    vcenter.skippedHosts,
+			APICalls:        vcenter.apiCalls,
+			Duration:        vcenter.elapsed.Round(time.Millisecond).String(),
+			ConnectDuration: vcenter.connectTime.Round(time.Millisecond).String(),
+			CollectDuration: vcenter.collectTime.Round(time.Millisecond).String(),
+			LookupDuration:  vcenter.lookupTime.Round(time.Millisecond).String(),
+			connect:         vcenter.connectTime,
+			collect:         vcenter.collectTime,
+			lookup:          vcenter.lookupTime,
+		}
+		if vcenter.skippedHosts > 0 && vcenter.err == nil {
+			s.Error = fmt.Sprintf("%d hosts skipped due to errors", vcenter.skippedHosts)
+		}
+		if vcenter.logoutErr != nil {
+			s.LogoutError = vcenter.logoutErr.Error()
+			summary.LogoutFailures++
+		}
+		if vcenter.err != nil {
+			s.Status = "failed"
+			if errors.Is(vcenter.err, context.Canceled) {
+				s.Status = "skipped"
+			}
+			s.Category = errorCategory(vcenter.err)
+			s.Retryable = retryable(vcenter.err)
+			s.Error = vcenter.err.Error()
+		}
+		if vcenter.firstErr != nil {
+			s.Retry = "recovered"
+			if vcenter.err != nil {
+				s.Retry = "failed"
+			}
+			s.FirstError = vcenter.firstErr.Error()
+		}
+		summary.Hosts += s.Hosts
+		summary.Rows += s.Rows
+		summary.SkippedHosts += s.SkippedHosts
+		summary.APICalls += s.APICalls
+		summary.VCenters = append(summary.VCenters, s)
+	}
+	return summary
+}
+
+// exitCode turns the collection's own exit code into the run's: 1 if every vcenter failed,
+// exitPartial if some did, unless FailOnPartial is off. Errors and shutdowns of the run come first.
+func (config Configuration) exitCode(code int, summary runSummary) int {
+	failed := 0
+	for _, s := range summary.VCenters {
+		if s.Status != "ok" {
+			failed++
+		}
+	}
+	switch {
+	case code != 0 && code != exitTooFewHosts && code != exitAlerts:
+		return code
+	case failed > 0 && failed == len(summary.VCenters):
+		return 1
+	case code != 0:
+		return code
+	case failed == 0:
+		return 0
+	case config.FailOnPartial == nil || *config.FailOnPartial:
+		return exitPartial
+	default:
+		return 0
+	}
+}
+
+// print writes the summary as a table and logs it
+func (summary runSummary) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VCENTER\tSTATUS\tHOSTS\tROWS\tAPI CALLS\tCONNECT\tCOLLECT\tLOOKUP\tDURATION\tERROR")
+	for _, s := range summary.VCenters {
+		status := s.Status
+		switch s.Retry {
+		case "recovered":
+			status = "ok (retried)"
+		case "failed":
+			status = "failed (twice)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n", s.Name, status, s.Hosts, s.Rows, s.APICalls, s.ConnectDuration, s.CollectDuration, s.LookupDuration, s.Duration, redact(s.Error))
+		slog.Info("vcenter summary", "vcenter", s.Hostname, "status", s.Status, "retry", s.Retry, "category", s.Category, "hosts", s.Hosts, "rows", s.Rows,
+			"skipped_hosts", s.SkippedHosts, "api_calls", s.APICalls, "connect", s.ConnectDuration, "collect", s.CollectDuration, "lookup", s.LookupDuration, "duration", s.Duration, "error", s.Error, "logout_error", s.LogoutError)
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t%d\t%d\t%d\t\t\t\t%s\t\n", summary.Hosts, summary.Rows, summary.APICalls, summary.Duration)
+	if summary.SkippedHosts > 0 {
+		fmt.Fprintf(tw, "SKIPPED\t\t%d\t\t\t\t\t\t\t%d hosts skipped due to errors\n", summary.SkippedHosts, summary.SkippedHosts)
+	}
+	for _, s := range summary.VCenters {
+		if s.LogoutError != "" {
+			fmt.Fprintf(tw, "LOGOUT %s\t\t\t\t\t\t\t\t\tlogout failed: %s\n", s.Name, redact(s.LogoutError))
+		}
+	}
+	for _, o := range summary.Outputs {
+		fmt.Fprintf(tw, "OUTPUT %s\t\t\t%d\t\t\t\t\t\t\n", o.Output, o.Rows)
+	}
+	if summary.MailError != "" {
+		fmt.Fprintf(tw, "MAIL\t\t\t\t\t\t\t\t\tmail failed: %s\n", redact(summary.MailError))
+	}
+	for _, a := range summary.Alerts {
+		where := a.Host
+		if where == "" {
+			where = a.Cluster
+		}
+		fmt.Fprintf(tw, "ALERT %s\t\t\t\t\t\t\t\t\t%s: %.2f\n", where, a.Rule, a.Value)
+	}
+	tw.Flush()
+	slog.Info("run summary", "vcenters", len(summary.VCenters), "hosts", summary.Hosts, "rows", summary.Rows, "skipped_hosts", summary.SkippedHosts, "logout_failures", summary.LogoutFailures, "mail_error", summary.MailError, "api_calls", summary.APICalls, "duration", summary.Duration, "alerts", len(summary.Alerts), "code", summary.ExitCode)
+}
+
+// summaryPath is the summary file next to the main output, hosts.csv gets hosts.summary.json
+func (config Configuration) summaryPath() string {
+	ext := filepath.Ext(config.Outpath)
+	return strings.TrimSuffix(config.Outpath, ext) + ".summary.json"
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/mo"
+)
+
+// switchStat is a virtual switch on a host, standard or distributed
+type switchStat struct {
+	Host       string
+	Switch     string
+	Type       string
+	Uplinks    int
+	PortGroups string
+}
+
+func (r switchStat) Headers() []string {
+	var res []string
+	t := reflect.TypeOf(r)
+	for i := 0; i < t.NumField(); i++ {
+		res = append(res, t.Field(i).Name)
+	}
+	return res
+}
+
+func (r switchStat) Slice() []string {
+	return []string{
+		r.Host,
+		r.Switch,
+		r.Type,
+		strconv.Itoa(r.Uplinks),
+		r.PortGroups,
+	}
+}
+
+// hostSwitches lists the standard and distributed switches of a host
+func hostSwitches(host string, hs mo.HostSystem) []switchStat {
+	if hs.Config == nil || hs.Config.Network == nil {
+		return nil
+	}
+
+	var switches []switchStat
+	for _, vs := range hs.Config.Network.Vswitch {
+		var portgroups []string
+		for _, key := range vs.Portgroup {
+			portgroups = append(portgroups, strings.TrimPrefix(key, "key-vim.host.PortGroup-"))
+		}
+		switches = append(switches, switchStat{
+			Host:       host,
+			Switch:     vs.Name,
+			Type:       "standard",
+			Uplinks:    len(vs.Pnic),
+			PortGroups: strings.Join(portgroups, ";"),
+		})
+	}
+	for _, ps := range hs.Config.Network.ProxySwitch {
+		switches = append(switches, switchStat{
+			Host:    host,
+			Switch:  ps.DvsName,
+			Type:    "distributed",
+			Uplinks: len(ps.Pnic),
+		})
+	}
+
+	return switches
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// lastActivity is when collection last made progress, in unix nanoseconds
+var lastActivity int64
+
+// markActivity records that collection is making progress, the systemd watchdog
+// stops pinging when a cycle shows none for a whole watchdog timeout
+func markActivity() {
+	atomic.StoreInt64(&lastActivity, time.Now().UnixNano())
+}
+
+// systemdNotifier implements the sd_notify protocol for Type=notify units.
+// A nil notifier, when NOTIFY_SOCKET is unset, does nothing.
+type systemdNotifier struct {
+	socket   string
+	watchdog time.Duration
+	ready    bool
+	busy     int32
+}
+
+func newSystemdNotifier() *systemdNotifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	n := &systemdNotifier{socket: socket}
+
+	pid, err := strconv.Atoi(os.Getenv("WATCHDOG_PID"))
+	if err != nil || pid == os.Getpid() {
+		usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+		if err == nil && usec > 0 {
+			n.watchdog = time.Duration(usec) * time.Microsecond
+		}
+	}
+	return n
+}
+
+func (n *systemdNotifier) notify(state string) {
+	if n == nil {
+		return
+	}
+	conn, err := net.Dial("unixgram", n.socket)
+	if err != nil {
+		slog.Warn("could not notify systemd", "error", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Warn("could not notify systemd", "error", err)
+	}
+}
+
+// cycleStarted and cycleDone bracket a collection cycle, the first successful one signals readiness
+func (n *systemdNotifier) cycleStarted(cycle int) {
+	if n == nil {
+		return
+	}
+	markActivity()
+	atomic.StoreInt32(&n.busy, 1)
+	n.notify(fmt.Sprintf("STATUS=Collection cycle %d running", cycle))
+}
+
+func (n *systemdNotifier) cycleDone(cycle int, code int, hosts int, elapsed time.Duration) {
+	if n == nil {
+		return
+	}
+	atomic.StoreInt32(&n.busy, 0)
+	status := fmt.Sprintf("STATUS=Cycle %d collected %d hosts in %s, exit code %d", cycle, hosts, elapsed.Round(time.Second), code)
+	if code == 0 && !n.ready {
+		n.ready = true
+		status = "READY=1\n" + status
+	}
+	n.notify(status)
+}
+
+// watch sends WATCHDOG=1 at half the watchdog timeout while the collector is
+// idle or its running cycle made progress within the timeout
+func (n *systemdNotifier) watch(quit <-chan struct{}) {
+	if n == nil || n.watchdog == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(n.watchdog / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+			}
+			idle := atomic.LoadInt32(&n.busy) == 0
+			last := time.Unix(0, atomic.LoadInt64(&lastActivity))
+			if idle || time.Since(last) < n.watchdog {
+				n.notify("WATCHDOG=1")
+			} else {
+				slog.Error("no collection progress, skipping watchdog ping", "since", last.Format(time.RFC3339))
+			}
+		}
+	}()
+}
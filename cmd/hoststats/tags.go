@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// tagColumns returns the columns for the configured TagCategories and CustomAttributes
+func (config Configuration) tagColumns() []string {
+	var columns []string
+	for _, category := range config.TagCategories {
+		columns = append(columns, "tag."+category)
+	}
+	for _, attribute := range config.CustomAttributes {
+		columns = append(columns, "attr."+attribute)
+	}
+	return columns
+}
+
+// hostTags returns, by host moref value, the tag and custom attribute columns of the hosts.
+// Several tags of one category are joined with ";", hosts without any are missing from the map.
+func (vcenter *VCenter) hostTags(ctx context.Context, config Configuration, hss []mo.HostSystem) (map[string]map[string]string, error) {
+	values := make(map[string]map[string]string)
+	set := func(host, column, value string) {
+		if values[host] == nil {
+			values[host] = make(map[string]string)
+		}
+		values[host][column] = value
+	}
+
+	if len(config.CustomAttributes) > 0 {
+		m, err := object.GetCustomFieldsManager(vcenter.client.Client)
+		if err != nil {
+			return nil, fmt.Errorf("custom attributes: %v", err)
+		}
+		fields, err := m.Field(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("custom attributes: %v", err)
+		}
+		wanted := make(map[int32]string)
+		for _, attribute := range config.CustomAttributes {
+			for _, field := range fields {
+				if field.Name == attribute {
+					wanted[field.Key] = "attr." + attribute
+				}
+			}
+		}
+		for _, hs := range hss {
+			for _, v := range hs.CustomValue {
+				value, ok := v.(*types.CustomFieldStringValue)
+				if column := wanted[v.GetCustomFieldValue().Key]; ok && column != "" {
+					set(hs.Reference().Value, column, value.Value)
+				}
+			}
+		}
+	}
+
+	if len(config.TagCategories) > 0 {
+		if vcenter.loginURL == nil || vcenter.Auth != "" && vcenter.Auth != "password" || vcenter.token() != "" {
+			return nil, fmt.Errorf("tags need password auth")
+		}
+		client := rest.NewClient(vcenter.client.Client)
+		if err := client.Login(ctx, vcenter.loginURL.User); err != nil {
+			return nil, fmt.Errorf("tags: could not login to the rest api: %v", err)
+		}
+		defer client.Logout(context.Background())
+
+		m := tags.NewManager(client)
+		for _, category := range config.TagCategories {
+			names := make(map[string][]string)
+			list, err := m.GetTagsForCategory(ctx, category)
+			if err != nil {
+				return nil, fmt.Errorf("tags of category %s: %v", category, err)
+			}
+			for _, tag := range list {
+				refs, err := m.ListAttachedObjects(ctx, tag.ID)
+				if err != nil {
+					return nil, fmt.Errorf("hosts tagged %s: %v", tag.Name, err)
+				}
+				for _, ref := range refs {
+					if ref.Reference().Type == "HostSystem" {
+						host := ref.Reference().Value
+						names[host] = append(names[host], tag.Name)
+					}
+				}
+			}
+			for host, tagged := range names {
+				sort.Strings(tagged)
+				set(host, "tag."+category, strings.Join(tagged, ";"))
+			}
+		}
+	}
+
+	return values, nil
+}
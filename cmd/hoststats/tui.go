@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/vmware/govmomi/units"
+)
+
+// tuiColumn is a column of the -tui host table, less orders it for sorting
+type tuiColumn struct {
+	title string
+	value func(hostStat) string
+	less  func(a, b hostStat) bool
+	right bool
+}
+
+func percentOf(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+func byText(value func(hostStat) string) func(a, b hostStat) bool {
+	return func(a, b hostStat) bool { return value(a) < value(b) }
+}
+
+func byNumber(value func(hostStat) float64) func(a, b hostStat) bool {
+	return func(a, b hostStat) bool { return value(a) < value(b) }
+}
+
+func freeCPUPercent(s hostStat) float64    { return percentOf(s.FreeCPU, s.TotalCPU) }
+func freeMemoryPercent(s hostStat) float64 { return percentOf(s.FreeMemory, s.MemorySize) }
+
+var tuiColumns = []tuiColumn{
+	{title: "Host", value: func(s hostStat) string { return s.Host }, less: byText(func(s hostStat) string { return s.Host })},
+	{title: "Cluster", value: func(s hostStat) string { return s.Cluster }, less: byText(func(s hostStat) string { return s.Cluster })},
+	{title: "VCenter", value: func(s hostStat) string { return s.VCenter }, less: byText(func(s hostStat) string { return s.VCenter })},
+	{title: "TotalCPU", right: true,
+		value: func(s hostStat) string { return strconv.FormatInt(s.TotalCPU, 10) + " MHz" },
+		less:  byNumber(func(s hostStat) float64 { return float64(s.TotalCPU) })},
+	{title: "FreeCPU", right: true,
+		value: func(s hostStat) string { return strconv.FormatInt(s.FreeCPU, 10) + " MHz" },
+		less:  byNumber(func(s hostStat) float64 { return float64(s.FreeCPU) })},
+	{title: "FreeCPU%", right: true,
+		value: func(s hostStat) string { return strconv.FormatFloat(freeCPUPercent(s), 'f', 1, 64) },
+		less:  byNumber(freeCPUPercent)},
+	{title: "Memory", right: true,
+		value: func(s hostStat) string { return units.ByteSize(s.MemorySize).String() },
+		less:  byNumber(func(s hostStat) float64 { return float64(s.MemorySize) })},
+	{title: "FreeMemory", right: true,
+		value: func(s hostStat) string { return units.ByteSize(s.FreeMemory).String() },
+		less:  byNumber(func(s hostStat) float64 { return float64(s.FreeMemory) })},
+	{title: "FreeMem%", right: true,
+		value: func(s hostStat) string { return strconv.FormatFloat(freeMemoryPercent(s), 'f', 1, 64) },
+		less:  byNumber(freeMemoryPercent)},
+	{title: "Version", value: func(s hostStat) string { return s.Version }, less: byText(func(s hostStat) string { return s.Version })},
+}
+
+// readStatsFile reads the hosts of a json output, as a plain array or under Hosts as written with ErrorReport.
+// Columns left out of the output are zero.
+func readStatsFile(path string) ([]hostStat, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var stats []hostStat
+	if err := json.NewDecoder(bytes.NewReader(b)).Decode(&stats); err != nil {
+		var report struct{ Hosts []hostStat }
+		if err := json.NewDecoder(bytes.NewReader(b)).Decode(&report); err != nil {
+			return nil, err
+		}
+		stats = report.Hosts
+	}
+	return stats, nil
+}
+
+// tuiScope is the tree node selected, an empty field matches every host
+type tuiScope struct {
+	vcenter, cluster string
+}
+
+// browser is the state of the -tui mode, it only works on the records it was given
+type browser struct {
+	stats   []hostStat
+	shown   []hostStat
+	scope   tuiScope
+	filter  string
+	sortCol int
+	desc    bool
+
+	app    *tview.Application
+	tree   *tview.TreeView
+	input  *tview.InputField
+	table  *tview.Table
+	detail *tview.TextView
+}
+
+// browse opens the terminal UI on stats and returns when it is quit with q or Esc
+func browse(stats []hostStat) error {
+	b := &browser{stats: stats, app: tview.NewApplication()}
+
+	b.tree = tview.NewTreeView()
+	b.tree.SetBorder(true).SetTitle(" vCenters ")
+	root := b.buildTree()
+	b.tree.SetRoot(root).SetCurrentNode(root)
+	b.tree.SetChangedFunc(func(node *tview.TreeNode) {
+		b.scope = node.GetReference().(tuiScope)
+		b.refresh()
+	})
+
+	b.input = tview.NewInputField().SetLabel("Filter: ").SetFieldWidth(0)
+	b.input.SetChangedFunc(func(text string) {
+		b.filter = strings.ToLower(strings.TrimSpace(text))
+		b.refresh()
+	})
+
+	b.table = tview.NewTable().SetFixed(1, 0).SetSelectable(true, false)
+	b.table.SetBorder(true).SetTitle(" Hosts ")
+	b.table.SetSelectionChangedFunc(func(row, column int) { b.showDetail(row) })
+
+	b.detail = tview.NewTextView().SetDynamicColors(false).SetScrollable(true)
+	b.detail.SetBorder(true).SetTitle(" Host ")
+
+	help := tview.NewTextView().SetText(" Tab: next pane   1-9,0: sort by column, again to reverse   /: filter   q, Esc: quit")
+
+	right := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(b.input, 1, 0, false).
+		AddItem(b.table, 0, 3, false).
+		AddItem(b.detail, 0, 2, false)
+	main := tview.NewFlex().
+		AddItem(b.tree, 0, 1, true).
+		AddItem(right, 0, 3, false)
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(main, 0, 1, true).
+		AddItem(help, 1, 0, false)
+
+	panes := []tview.Primitive{b.tree, b.input, b.table, b.detail}
+	b.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		typing := b.app.GetFocus() == b.input
+		switch {
+		case event.Key() == tcell.KeyTab:
+			for i, pane := range panes {
+				if pane == b.app.GetFocus() {
+					b.app.SetFocus(panes[(i+1)%len(panes)])
+					break
+				}
+			}
+			return nil
+		case event.Key() == tcell.KeyEscape && typing:
+			b.app.SetFocus(b.table)
+			return nil
+		case event.Key() == tcell.KeyEscape, event.Rune() == 'q' && !typing:
+			b.app.Stop()
+			return nil
+		case event.Rune() == '/' && !typing:
+			b.app.SetFocus(b.input)
+			return nil
+		case event.Rune() >= '0' && event.Rune() <= '9' && !typing:
+			col := int(event.Rune() - '1')
+			if event.Rune() == '0' {
+				col = 9
+			}
+			if col < len(tuiColumns) {
+				b.sortBy(col)
+			}
+			return nil
+		}
+		return event
+	})
+
+	b.refresh()
+	return b.app.SetRoot(layout, true).Run()
+}
+
+// buildTree makes the vcenter → cluster → host tree, hosts are leaves that select their cluster
+func (b *browser) buildTree() *tview.TreeNode {
+	sorted := append([]hostStat(nil), b.stats...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].VCenter != sorted[j].VCenter {
+			return sorted[i].VCenter < sorted[j].VCenter
+		}
+		if sorted[i].Cluster != sorted[j].Cluster {
+			return sorted[i].Cluster < sorted[j].Cluster
+		}
+		return sorted[i].Host < sorted[j].Host
+	})
+
+	root := tview.NewTreeNode(fmt.Sprintf("all (%d)", len(sorted))).SetReference(tuiScope{})
+	var vnode, cnode *tview.TreeNode
+	var vhosts, chosts int
+	var last tuiScope
+	for i, s := range sorted {
+		if i == 0 || s.VCenter != last.vcenter {
+			vnode, vhosts = expandable(tuiScope{vcenter: s.VCenter}), 0
+			root.AddChild(vnode)
+		}
+		scope := tuiScope{vcenter: s.VCenter, cluster: s.Cluster}
+		if i == 0 || scope != last {
+			cnode, chosts = expandable(scope).SetExpanded(false), 0
+			vnode.AddChild(cnode)
+		}
+		vhosts++
+		chosts++
+		vnode.SetText(fmt.Sprintf("%s (%d)", s.VCenter, vhosts))
+		cnode.SetText(fmt.Sprintf("%s (%d)", s.Cluster, chosts))
+		cnode.AddChild(tview.NewTreeNode(s.Host).SetReference(scope))
+		last = scope
+	}
+	return root
+}
+
+// expandable is a tree node for scope that opens and closes when selected
+func expandable(scope tuiScope) *tview.TreeNode {
+	node := tview.NewTreeNode("").SetReference(scope)
+	node.SetSelectedFunc(func() { node.SetExpanded(!node.IsExpanded()) })
+	return node
+}
+
+// matches reports whether s is in the selected tree node and matches the filter
+func (b *browser) matches(s hostStat) bool {
+	if b.scope.vcenter != "" && s.VCenter != b.scope.vcenter {
+		return false
+	}
+	if b.scope.cluster != "" && s.Cluster != b.scope.cluster {
+		return false
+	}
+	if b.filter == "" {
+		return true
+	}
+	for _, value := range []string{s.Host, s.Cluster, s.VCenter, s.Model, s.Version} {
+		if strings.Contains(strings.ToLower(value), b.filter) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *browser) sortBy(col int) {
+	if b.sortCol == col {
+		b.desc = !b.desc
+	} else {
+		b.sortCol, b.desc = col, false
+	}
+	b.refresh()
+}
+
+// refresh redraws the table for the scope, filter and sort order
+func (b *browser) refresh() {
+	b.shown = b.shown[:0]
+	for _, s := range b.stats {
+		if b.matches(s) {
+			b.shown = append(b.shown, s)
+		}
+	}
+	less := tuiColumns[b.sortCol].less
+	sort.SliceStable(b.shown, func(i, j int) bool {
+		if b.desc {
+			return less(b.shown[j], b.shown[i])
+		}
+		return less(b.shown[i], b.shown[j])
+	})
+
+	b.table.Clear()
+	for i, col := range tuiColumns {
+		title := col.title
+		if i == b.sortCol {
+			title += map[bool]string{false: " ▲", true: " ▼"}[b.desc]
+		}
+		b.table.SetCell(0, i, tview.NewTableCell(title).SetTextColor(tcell.ColorYellow).SetSelectable(false).SetExpansion(1))
+	}
+	for row, s := range b.shown {
+		for i, col := range tuiColumns {
+			cell := tview.NewTableCell(col.value(s))
+			if col.right {
+				cell.SetAlign(tview.AlignRight)
+			}
+			b.table.SetCell(row+1, i, cell)
+		}
+	}
+	b.table.SetTitle(fmt.Sprintf(" Hosts (%d of %d) ", len(b.shown), len(b.stats)))
+	b.table.Select(1, 0).ScrollToBeginning()
+	b.showDetail(1)
+}
+
+// showDetail fills the detail pane with every field of the host on row of the table
+func (b *browser) showDetail(row int) {
+	b.detail.Clear().SetTitle(" Host ")
+	if row < 1 || row > len(b.shown) {
+		return
+	}
+	s := b.shown[row-1]
+	headers, values := s.Headers(), s.Slice()
+	width := 0
+	for _, h := range headers {
+		if len(h) > width {
+			width = len(h)
+		}
+	}
+	var text strings.Builder
+	for i, h := range headers {
+		fmt.Fprintf(&text, "%-*s  %s\n", width, h, values[i])
+	}
+	for _, extra := range []struct {
+		prefix string
+		values map[string]string
+	}{{"label.", s.Labels}, {"tag.", s.Tags}} {
+		var keys []string
+		for key := range extra.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&text, "%-*s  %s\n", width, extra.prefix+key, extra.values[key])
+		}
+	}
+	b.detail.SetText(text.String()).ScrollToBeginning()
+	b.detail.SetTitle(" " + s.Host + " ")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// provisionedVCPUs returns the number of vCPUs assigned to the VMs of each host, by moref value.
+// Hosts without VMs are missing from the map. All VMs are looked up in one call.
+func provisionedVCPUs(ctx context.Context, pc *property.Collector, hss []mo.HostSystem) (map[string]int, error) {
+	vcpus := make(map[string]int)
+
+	var refs []types.ManagedObjectReference
+	for _, hs := range hss {
+		refs = append(refs, hs.Vm...)
+	}
+	if len(refs) == 0 {
+		return vcpus, nil
+	}
+
+	var vms []mo.VirtualMachine
+	if err := pc.Retrieve(ctx, refs, []string{"config.hardware.numCPU"}, &vms); err != nil {
+		return nil, err
+	}
+	numCPU := make(map[types.ManagedObjectReference]int32)
+	for _, vm := range vms {
+		// templates and VMs being created may have no config yet
+		if vm.Config != nil {
+			numCPU[vm.Reference()] = vm.Config.Hardware.NumCPU
+		}
+	}
+
+	for _, hs := range hss {
+		for _, ref := range hs.Vm {
+			vcpus[hs.Reference().Value] += int(numCPU[ref])
+		}
+	}
+
+	return vcpus, nil
+}
@@ -0,0 +1,56 @@
+package collector
+
+import "github.com/vmware/govmomi/vim25/types"
+
+// The host summary mixes units: the hardware summary has the clock of one core in MHz and the memory
+// in bytes, the quick stats have the CPU used in MHz and the memory used in MB. The columns are MHz
+// for CPU and bytes for memory, every conversion goes through the functions below in int64, a
+// 128 core host at 3.5GHz or with terabytes of memory is well past what int32 holds.
+
+const bytesPerMB = 1024 * 1024
+
+// CPUCapacityMHz is the nominal CPU capacity of the host, every core at its base clock
+func CPUCapacityMHz(hw *types.HostHardwareSummary) int64 {
+	if hw == nil {
+		return 0
+	}
+	return int64(hw.CpuMhz) * int64(hw.NumCpuCores)
+}
+
+// CPUUsedMHz is the CPU in use on the host. With turbo boost the cores run above their base clock,
+// so it can be more than CPUCapacityMHz.
+func CPUUsedMHz(qs types.HostListSummaryQuickStats) int64 {
+	return int64(qs.OverallCpuUsage)
+}
+
+// CPUFreeMHz is the capacity not in use, 0 when the host uses all of it or more
+func CPUFreeMHz(capacity, used int64) int64 {
+	return max(capacity-used, 0)
+}
+
+// MemUsedBytes is the memory in use on the host, the quick stats count it in MB
+func MemUsedBytes(qs types.HostListSummaryQuickStats) int64 {
+	return MBToBytes(int64(qs.OverallMemoryUsage))
+}
+
+// MBToBytes converts memory counted in MB, like the effective memory of a cluster, to bytes
+func MBToBytes(mb int64) int64 {
+	return mb * bytesPerMB
+}
+
+// MemFreeBytes is the memory not in use, 0 when the host uses all of it or more
+func MemFreeBytes(hw *types.HostHardwareSummary, used int64) int64 {
+	if hw == nil {
+		return 0
+	}
+	return max(hw.MemorySize-used, 0)
+}
+
+// UsagePercent is used as a percentage of capacity, above 100 when the host runs past its capacity
+// and 0 without any
+func UsagePercent(used, capacity int64) float64 {
+	if capacity <= 0 {
+		return 0
+	}
+	return float64(used) / float64(capacity) * 100
+}
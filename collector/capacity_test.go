@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestCPU(t *testing.T) {
+	tests := []struct {
+		name           string
+		hw             *types.HostHardwareSummary
+		used           int32
+		capacity, free int64
+		percent        float64
+	}{
+		{"half used", &types.HostHardwareSummary{CpuMhz: 2000, NumCpuCores: 16}, 16000, 32000, 16000, 50},
+		{"idle", &types.HostHardwareSummary{CpuMhz: 2000, NumCpuCores: 16}, 0, 32000, 32000, 0},
+		// turbo boost runs the cores above their base clock
+		{"past capacity", &types.HostHardwareSummary{CpuMhz: 2000, NumCpuCores: 16}, 40000, 32000, 0, 125},
+		// 128 cores at 3.5GHz is past what int32 holds in kHz, the capacity has to be computed in int64
+		{"large host", &types.HostHardwareSummary{CpuMhz: 3500, NumCpuCores: 128}, 112000, 448000, 336000, 25},
+		{"no hardware summary", nil, 100, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		capacity := CPUCapacityMHz(tt.hw)
+		used := CPUUsedMHz(types.HostListSummaryQuickStats{OverallCpuUsage: tt.used})
+		if capacity != tt.capacity {
+			t.Errorf("%s: capacity %d MHz, want %d", tt.name, capacity, tt.capacity)
+		}
+		if free := CPUFreeMHz(capacity, used); free != tt.free {
+			t.Errorf("%s: %d MHz free, want %d", tt.name, free, tt.free)
+		}
+		if percent := UsagePercent(used, capacity); percent != tt.percent {
+			t.Errorf("%s: %v%% used, want %v", tt.name, percent, tt.percent)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	tests := []struct {
+		name       string
+		hw         *types.HostHardwareSummary
+		usedMB     int32
+		used, free int64
+		percent    float64
+	}{
+		{"quarter used", &types.HostHardwareSummary{MemorySize: 256 * gb}, 64 * 1024, 64 * gb, 192 * gb, 25},
+		{"over committed", &types.HostHardwareSummary{MemorySize: 16 * gb}, 32 * 1024, 32 * gb, 0, 200},
+		// terabytes are past what int32 holds in bytes
+		{"terabytes", &types.HostHardwareSummary{MemorySize: 6 * 1024 * gb}, 3 * 1024 * 1024, 3 * 1024 * gb, 3 * 1024 * gb, 50},
+		{"no hardware summary", nil, 1024, gb, 0, 0},
+	}
+	for _, tt := range tests {
+		used := MemUsedBytes(types.HostListSummaryQuickStats{OverallMemoryUsage: tt.usedMB})
+		if used != tt.used {
+			t.Errorf("%s: %d bytes used, want %d", tt.name, used, tt.used)
+		}
+		if free := MemFreeBytes(tt.hw, used); free != tt.free {
+			t.Errorf("%s: %d bytes free, want %d", tt.name, free, tt.free)
+		}
+		var size int64
+		if tt.hw != nil {
+			size = tt.hw.MemorySize
+		}
+		if percent := UsagePercent(used, size); percent != tt.percent {
+			t.Errorf("%s: %v%% used, want %v", tt.name, percent, tt.percent)
+		}
+	}
+}
+
+func TestMBToBytes(t *testing.T) {
+	for mb, want := range map[int64]int64{0: 0, 1: 1 << 20, 1024: 1 << 30, 8 * 1024 * 1024: 8 << 40} {
+		if got := MBToBytes(mb); got != want {
+			t.Errorf("MBToBytes(%d) = %d, want %d", mb, got, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// Cluster is what a host takes from its cluster, DrsAutomationLevel is empty when DRS is off
+type Cluster struct {
+	Name               string
+	DrsEnabled         bool
+	DrsAutomationLevel string
+}
+
+// ClusterCache keeps the clusters of one vcenter between collections, references are only unique within one
+type ClusterCache interface {
+	Cluster(ref types.ManagedObjectReference) (Cluster, bool)
+	StoreCluster(ref types.ManagedObjectReference, cluster Cluster)
+}
+
+// clusters returns the clusters the hosts are in. The clusters missing from the cache are looked up
+// in one retrieve, hosts outside a cluster get StandaloneCluster and no DRS.
+func (config VCenterConfig) clusters(ctx context.Context, pc *property.Collector, hss []mo.HostSystem) (map[types.ManagedObjectReference]Cluster, error) {
+	clusters := make(map[types.ManagedObjectReference]Cluster)
+	var missing []types.ManagedObjectReference
+	for _, hs := range hss {
+		if hs.Parent == nil {
+			continue
+		}
+		if _, ok := clusters[*hs.Parent]; ok {
+			continue
+		}
+		if hs.Parent.Type == "ComputeResource" {
+			// a host outside a cluster sits in a ComputeResource of its own, named after the host
+			clusters[*hs.Parent] = Cluster{Name: StandaloneCluster}
+			continue
+		}
+		var cluster Cluster
+		cached := false
+		if config.Clusters != nil {
+			cluster, cached = config.Clusters.Cluster(*hs.Parent)
+		}
+		clusters[*hs.Parent] = cluster
+		if !cached {
+			missing = append(missing, *hs.Parent)
+		}
+	}
+	if len(missing) == 0 {
+		return clusters, nil
+	}
+
+	var found []mo.ClusterComputeResource
+	err := config.retrieve(ctx, func(ctx context.Context) error {
+		return pc.Retrieve(ctx, missing, []string{"name", "configurationEx"}, &found)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range found {
+		cluster := Cluster{Name: c.Name}
+		if ex, ok := c.ConfigurationEx.(*types.ClusterConfigInfoEx); ok {
+			drs := ex.DrsConfig
+			cluster.DrsEnabled = drs.Enabled != nil && *drs.Enabled
+			if cluster.DrsEnabled {
+				cluster.DrsAutomationLevel = string(drs.DefaultVmBehavior)
+			}
+		}
+		clusters[c.Reference()] = cluster
+		if config.Clusters != nil {
+			config.Clusters.StoreCluster(c.Reference(), cluster)
+		}
+	}
+	return clusters, nil
+}
@@ -0,0 +1,220 @@
+// Package collector collects the hosts of a vcenter with a govmomi client the caller logged in.
+// It is the part of hostStats other programs can import, the hostStats command adds its outputs,
+// configuration and scheduling on top.
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// StandaloneCluster is the Cluster of a host that is not in a cluster
+const StandaloneCluster = "(standalone)"
+
+// hostProperties are the HostSystem properties a HostStat is read from
+var hostProperties = []string{"summary", "parent", "hardware", "config"}
+
+// VCenterConfig is what Collect needs of one vcenter. The client is connected and logged in by the caller,
+// with whatever govmomi options, proxy or session handling it needs, and is left logged in.
+type VCenterConfig struct {
+	Client *vim25.Client
+	// only collect the hosts of these datacenters, matched without case, all of them when empty
+	Datacenters []string
+	// the HostSystem properties to retrieve, those a HostStat is read from when empty. HostStat fields
+	// whose properties are left out stay empty, the cluster and datacenter need parent.
+	Properties []string
+	// above one the hosts are listed first and their properties retrieved in that many batches at once
+	Concurrency int
+	// bounds every retrieve, of the hosts and of each lookup, unbounded when 0. A retrieve that takes
+	// longer fails with an error wrapping context.DeadlineExceeded.
+	RetrieveTimeout time.Duration
+	// keeps the clusters between collections, only those it misses are looked up. Every cluster is
+	// looked up when nil.
+	Clusters ClusterCache
+}
+
+// HostStat is one host as collected, CPU is in MHz and memory in bytes. The capacity fields are 0
+// unless the host is connected.
+type HostStat struct {
+	Datacenter         string
+	Cluster            string
+	DrsEnabled         bool
+	DrsAutomationLevel string
+	Host               string
+	MoRef              string
+	ConnectionState    string
+	Version            string
+	Build              string
+	FullVersion        string
+	Vendor             string
+	Model              string
+	NumCpuPkgs         int16
+	NumCpuCores        int16
+	NumCpuThreads      int16
+	CpuModel           string
+	TotalCPU           int64
+	FreeCPU            int64
+	CpuUsagePercent    float64
+	OverallMemoryUsage int64
+	MemorySize         int64
+	FreeMemory         int64
+	MemoryUsagePercent float64
+	NtpServers         string
+	NtpRunning         bool
+	MaintenanceMode    bool
+	PowerState         string
+}
+
+// Result is what Collect gathered from one vcenter
+type Result struct {
+	Hosts []HostStat
+	// the hosts as retrieved, in the order of Hosts, for the properties a HostStat doesn't read
+	Systems []mo.HostSystem
+	// the configured Datacenters that match none on the vcenter
+	MissingDatacenters []string
+	// the part of the collection spent looking up the clusters
+	LookupTime time.Duration
+}
+
+// LookupError is the error of a Collect that retrieved the hosts but could not look up all of their
+// clusters or datacenters. The Result still has the hosts, with the Cluster or Datacenter left empty.
+type LookupError struct {
+	Clusters    error
+	Datacenters error
+}
+
+func (e *LookupError) Error() string {
+	var msgs []string
+	if e.Clusters != nil {
+		msgs = append(msgs, "could not look up the clusters of the hosts: "+e.Clusters.Error())
+	}
+	if e.Datacenters != nil {
+		msgs = append(msgs, "could not look up the datacenters of the hosts: "+e.Datacenters.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *LookupError) Unwrap() []error {
+	var errs []error
+	for _, err := range []error{e.Clusters, e.Datacenters} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Collect returns the hosts of the vcenter. When only the cluster or datacenter lookup fails the error
+// is a *LookupError and the Result has the hosts, any other error leaves it empty.
+func Collect(ctx context.Context, config VCenterConfig) (Result, error) {
+	if config.Client == nil {
+		return Result{}, errors.New("no client, connect and log in first")
+	}
+
+	roots, missing, err := config.roots(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("could not find the datacenters: %w", err)
+	}
+	result := Result{MissingDatacenters: missing}
+	for _, root := range roots {
+		found, err := config.hosts(ctx, root)
+		if err != nil {
+			return Result{}, err
+		}
+		result.Systems = append(result.Systems, found...)
+	}
+
+	pc := property.DefaultCollector(config.Client)
+	var lookupErr LookupError
+	start := time.Now()
+	clusters, err := config.clusters(ctx, pc, result.Systems)
+	result.LookupTime = time.Since(start)
+	lookupErr.Clusters = err
+	var datacenters map[types.ManagedObjectReference]string
+	lookupErr.Datacenters = config.retrieve(ctx, func(ctx context.Context) error {
+		datacenters, err = HostDatacenters(ctx, pc, result.Systems)
+		return err
+	})
+
+	result.Hosts = make([]HostStat, 0, len(result.Systems))
+	for _, hs := range result.Systems {
+		stat := NewHostStat(hs)
+		if hs.Parent != nil {
+			cluster := clusters[*hs.Parent]
+			stat.Cluster, stat.DrsEnabled, stat.DrsAutomationLevel = cluster.Name, cluster.DrsEnabled, cluster.DrsAutomationLevel
+			stat.Datacenter = datacenters[*hs.Parent]
+		}
+		result.Hosts = append(result.Hosts, stat)
+	}
+	if lookupErr.Clusters != nil || lookupErr.Datacenters != nil {
+		return result, &lookupErr
+	}
+	return result, nil
+}
+
+// retrieve runs a retrieve bounded by RetrieveTimeout, one that ran out of it is told apart from a cancelled ctx
+func (config VCenterConfig) retrieve(ctx context.Context, retrieve func(ctx context.Context) error) error {
+	if config.RetrieveTimeout <= 0 {
+		return retrieve(ctx)
+	}
+	retrieving, cancel := context.WithTimeout(ctx, config.RetrieveTimeout)
+	defer cancel()
+	err := retrieve(retrieving)
+	if err != nil && ctx.Err() == nil && retrieving.Err() != nil {
+		return fmt.Errorf("%w: retrieve took longer than %s: %v", context.DeadlineExceeded, config.RetrieveTimeout, err)
+	}
+	return err
+}
+
+// NewHostStat reads what a host tells about itself, the Cluster and Datacenter need lookups and are left empty
+func NewHostStat(hs mo.HostSystem) HostStat {
+	stat := HostStat{Host: hs.Summary.Config.Name, MoRef: hs.Reference().Value, FullVersion: FullVersion(hs)}
+	if stat.Host == "" {
+		// a host that never connected has no summary config
+		stat.Host = stat.MoRef
+	}
+	stat.NtpServers, stat.NtpRunning = NTP(hs)
+
+	connected := true
+	if runtime := hs.Summary.Runtime; runtime != nil {
+		stat.ConnectionState = string(runtime.ConnectionState)
+		stat.MaintenanceMode = runtime.InMaintenanceMode
+		stat.PowerState = string(runtime.PowerState)
+		connected = runtime.ConnectionState == types.HostSystemConnectionStateConnected
+	}
+	if hw := hs.Summary.Hardware; hw != nil {
+		stat.NumCpuPkgs = hw.NumCpuPkgs
+		stat.NumCpuCores = hw.NumCpuCores
+		stat.NumCpuThreads = hw.NumCpuThreads
+		stat.CpuModel = hw.CpuModel
+		// a disconnected host keeps its last hardware summary but has no capacity to offer
+		if connected {
+			qs := hs.Summary.QuickStats
+			stat.TotalCPU = CPUCapacityMHz(hw)
+			used := CPUUsedMHz(qs)
+			stat.FreeCPU = CPUFreeMHz(stat.TotalCPU, used)
+			stat.CpuUsagePercent = UsagePercent(used, stat.TotalCPU)
+			stat.OverallMemoryUsage = MemUsedBytes(qs)
+			stat.MemorySize = hw.MemorySize
+			stat.FreeMemory = MemFreeBytes(hw, stat.OverallMemoryUsage)
+			stat.MemoryUsagePercent = UsagePercent(stat.OverallMemoryUsage, hw.MemorySize)
+		}
+	}
+	if hs.Config != nil {
+		stat.Version = hs.Config.Product.Version
+		stat.Build = hs.Config.Product.Build
+	}
+	if hs.Hardware != nil {
+		stat.Vendor = hs.Hardware.SystemInfo.Vendor
+		stat.Model = hs.Hardware.SystemInfo.Model
+	}
+	return stat
+}
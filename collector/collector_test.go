@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// clusterMap is a ClusterCache counting the clusters stored in it
+type clusterMap map[types.ManagedObjectReference]Cluster
+
+func (m clusterMap) Cluster(ref types.ManagedObjectReference) (Cluster, bool) {
+	cluster, ok := m[ref]
+	return cluster, ok
+}
+
+func (m clusterMap) StoreCluster(ref types.ManagedObjectReference, cluster Cluster) {
+	m[ref] = cluster
+}
+
+func TestCollect(t *testing.T) {
+	model := simulator.VPX()
+	if err := model.Create(); err != nil {
+		t.Fatal(err)
+	}
+	defer model.Remove()
+	server := model.Service.NewServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	client, err := govmomi.NewClient(ctx, server.URL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Logout(ctx)
+
+	for _, concurrency := range []int{0, 2} {
+		cache := make(clusterMap)
+		config := VCenterConfig{Client: client.Client, Datacenters: []string{"dc0", "DC9"}, Concurrency: concurrency, Clusters: cache}
+		result, err := Collect(ctx, config)
+		if err != nil {
+			t.Fatalf("concurrency %d: %v", concurrency, err)
+		}
+		if len(result.MissingDatacenters) != 1 || result.MissingDatacenters[0] != "DC9" {
+			t.Errorf("concurrency %d: missing datacenters %v, want DC9", concurrency, result.MissingDatacenters)
+		}
+		// the vcsim vcenter model has a standalone host and a cluster of three
+		if len(result.Hosts) != 4 || len(result.Systems) != 4 {
+			t.Fatalf("concurrency %d: %d hosts and %d systems, want 4", concurrency, len(result.Hosts), len(result.Systems))
+		}
+		standalone := 0
+		for i, host := range result.Hosts {
+			if host.MoRef != result.Systems[i].Reference().Value {
+				t.Errorf("concurrency %d: host %s next to system %s", concurrency, host.MoRef, result.Systems[i].Reference().Value)
+			}
+			if host.Datacenter != "DC0" || host.Cluster == "" || host.TotalCPU == 0 {
+				t.Errorf("concurrency %d: host %s in datacenter %q and cluster %q with %d MHz", concurrency, host.Host, host.Datacenter, host.Cluster, host.TotalCPU)
+			}
+			if host.Cluster == StandaloneCluster {
+				standalone++
+			}
+		}
+		if standalone != 1 || len(cache) != 1 {
+			t.Errorf("concurrency %d: %d standalone hosts and %d clusters cached, want 1 of each", concurrency, standalone, len(cache))
+		}
+
+		// a cached cluster is not looked up again
+		for ref := range cache {
+			cache[ref] = Cluster{Name: "cached"}
+		}
+		result, err = Collect(ctx, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, host := range result.Hosts {
+			if host.Cluster != StandaloneCluster && host.Cluster != "cached" {
+				t.Errorf("concurrency %d: host %s in cluster %q, want the cached one", concurrency, host.Host, host.Cluster)
+			}
+		}
+	}
+}
+
+func TestCollectWithoutClient(t *testing.T) {
+	if _, err := Collect(context.Background(), VCenterConfig{}); err == nil {
+		t.Error("no error without a client")
+	}
+}
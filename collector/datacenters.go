@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// HostDatacenters returns the datacenter of every host parent, walking up from the compute resource of the
+// host through the folders above it, however deeply nested, until a datacenter is reached. Every object
+// on the way is retrieved once, so hosts and clusters sharing a datacenter cost one lookup of its name.
+func HostDatacenters(ctx context.Context, pc *property.Collector, hss []mo.HostSystem) (map[types.ManagedObjectReference]string, error) {
+	parents := make(map[types.ManagedObjectReference]types.ManagedObjectReference)
+	names := make(map[types.ManagedObjectReference]string)
+	var pending []types.ManagedObjectReference
+	for _, hs := range hss {
+		if hs.Parent == nil {
+			continue
+		}
+		if _, ok := parents[*hs.Parent]; !ok {
+			parents[*hs.Parent] = types.ManagedObjectReference{}
+			pending = append(pending, *hs.Parent)
+		}
+	}
+
+	for len(pending) > 0 {
+		// a retrieve takes objects of one type, standalone hosts and clusters or folders and datacenters
+		// can be on the same level
+		byType := make(map[string][]types.ManagedObjectReference)
+		var kinds []string
+		for _, ref := range pending {
+			if _, ok := byType[ref.Type]; !ok {
+				kinds = append(kinds, ref.Type)
+			}
+			byType[ref.Type] = append(byType[ref.Type], ref)
+		}
+		var found []mo.ManagedEntity
+		for _, kind := range kinds {
+			var entities []mo.ManagedEntity
+			if err := pc.Retrieve(ctx, byType[kind], []string{"name", "parent"}, &entities); err != nil {
+				return nil, err
+			}
+			found = append(found, entities...)
+		}
+		pending = nil
+		for _, entity := range found {
+			ref := entity.Reference()
+			if ref.Type == "Datacenter" {
+				names[ref] = entity.Name
+				continue
+			}
+			if entity.Parent == nil {
+				continue
+			}
+			parents[ref] = *entity.Parent
+			if _, ok := parents[*entity.Parent]; !ok {
+				parents[*entity.Parent] = types.ManagedObjectReference{}
+				pending = append(pending, *entity.Parent)
+			}
+		}
+	}
+
+	datacenters := make(map[types.ManagedObjectReference]string)
+	for _, hs := range hss {
+		if hs.Parent == nil {
+			continue
+		}
+		ref := *hs.Parent
+		// the walk ends at a datacenter or at an object without a parent, a cycle can't occur in the inventory
+		for ref.Type != "Datacenter" && ref.Value != "" {
+			ref = parents[ref]
+		}
+		datacenters[*hs.Parent] = names[ref]
+	}
+	return datacenters, nil
+}
@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// roots are the host folders of the configured datacenters, or the root folder without any, along with
+// the configured names that match no datacenter
+func (config VCenterConfig) roots(ctx context.Context) ([]types.ManagedObjectReference, []string, error) {
+	c := config.Client
+	if len(config.Datacenters) == 0 {
+		return []types.ManagedObjectReference{c.ServiceContent.RootFolder}, nil, nil
+	}
+
+	v, err := view.NewManager(c).CreateContainerView(ctx, c.ServiceContent.RootFolder, []string{"Datacenter"}, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer v.Destroy(ctx)
+	var dcs []mo.Datacenter
+	err = config.retrieve(ctx, func(ctx context.Context) error {
+		return v.Retrieve(ctx, []string{"Datacenter"}, []string{"name", "hostFolder"}, &dcs)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var roots []types.ManagedObjectReference
+	var missing []string
+	for _, name := range config.Datacenters {
+		matched := false
+		for _, dc := range dcs {
+			if strings.EqualFold(dc.Name, name) {
+				roots = append(roots, dc.HostFolder)
+				matched = true
+			}
+		}
+		if !matched {
+			missing = append(missing, name)
+		}
+	}
+	return roots, missing, nil
+}
+
+// hosts retrieves the hosts under root. With a Concurrency above one the host references are listed
+// first and their properties retrieved in that many batches at once, otherwise in one retrieve.
+func (config VCenterConfig) hosts(ctx context.Context, root types.ManagedObjectReference) ([]mo.HostSystem, error) {
+	v, err := view.NewManager(config.Client).CreateContainerView(ctx, root, []string{"HostSystem"}, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the host view: %w", err)
+	}
+	defer v.Destroy(ctx)
+
+	properties := config.Properties
+	if len(properties) == 0 {
+		properties = hostProperties
+	}
+	if config.Concurrency <= 1 {
+		var found []mo.HostSystem
+		err := config.retrieve(ctx, func(ctx context.Context) error {
+			return v.Retrieve(ctx, []string{"HostSystem"}, properties, &found)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve the hosts: %w", err)
+		}
+		return found, nil
+	}
+
+	pc := property.DefaultCollector(config.Client)
+	var listed mo.ContainerView
+	err = config.retrieve(ctx, func(ctx context.Context) error {
+		return pc.RetrieveOne(ctx, v.Reference(), []string{"view"}, &listed)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list the hosts: %w", err)
+	}
+	refs := listed.View
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	size := (len(refs) + config.Concurrency - 1) / config.Concurrency
+	var batches [][]types.ManagedObjectReference
+	for len(refs) > 0 {
+		n := min(size, len(refs))
+		batches = append(batches, refs[:n])
+		refs = refs[n:]
+	}
+
+	found := make([][]mo.HostSystem, len(batches))
+	errs := make([]error, len(batches))
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		wg.Add(1)
+		go func(i int, batch []types.ManagedObjectReference) {
+			defer wg.Done()
+			errs[i] = config.retrieve(ctx, func(ctx context.Context) error {
+				return pc.Retrieve(ctx, batch, properties, &found[i])
+			})
+		}(i, batch)
+	}
+	wg.Wait()
+
+	var hss []mo.HostSystem
+	for i := range batches {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("could not retrieve the hosts: %w", errs[i])
+		}
+		hss = append(hss, found[i]...)
+	}
+	return hss, nil
+}
@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/mo"
+)
+
+// NTP returns the configured NTP servers joined by ";" and whether ntpd is running
+func NTP(hs mo.HostSystem) (string, bool) {
+	if hs.Config == nil {
+		return "", false
+	}
+
+	var servers string
+	if hs.Config.DateTimeInfo != nil && hs.Config.DateTimeInfo.NtpConfig != nil {
+		servers = strings.Join(hs.Config.DateTimeInfo.NtpConfig.Server, ";")
+	}
+
+	var running bool
+	if hs.Config.Service != nil {
+		for _, service := range hs.Config.Service.Service {
+			if service.Key == "ntpd" {
+				running = service.Running
+				break
+			}
+		}
+	}
+
+	return servers, running
+}
@@ -0,0 +1,30 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/vmware/govmomi/vim25/mo"
+)
+
+// updateLevelOption is the advanced setting holding the update a host is on, 3 for ESXi 7.0 Update 3
+const updateLevelOption = "Misc.HostAgentUpdateLevel"
+
+// FullVersion is the product's full name, like "VMware ESXi 7.0.3 build-20036589", followed by the update
+// level when the host is on an update, as in "(Update 3)". It is empty when the host config is missing.
+func FullVersion(hs mo.HostSystem) string {
+	if hs.Config == nil {
+		return ""
+	}
+	name := hs.Config.Product.FullName
+	for _, option := range hs.Config.Option {
+		o := option.GetOptionValue()
+		if o.Key != updateLevelOption {
+			continue
+		}
+		if level := fmt.Sprint(o.Value); level != "" && level != "0" {
+			name += " (Update " + level + ")"
+		}
+		break
+	}
+	return name
+}
@@ -0,0 +1,295 @@
+// Package config reads the hostStats configuration file. Config is the file as written, validating
+// it and everything derived from it is up to the command.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is the configuration file, read as JSON or TOML with the same names
+type Config struct {
+	Outpath         string
+	Format          string
+	PrettyJSON      bool
+	OutputOptions   RawOptions
+	SkipEmptyOutput bool
+	MailResult      bool
+	VCenters        []*VCenter
+	VCentersFile    string
+	SwitchOutpath   string
+	SiteRegex       string
+	SessionCache    string
+	Mail            *Mail
+	Fields          []string
+	ExcludeColumns  []string
+	RedactColumns   []string
+	ExtraOutputs    []Output
+	Interval        Duration
+	Schedule        string
+	Timezone        string
+
+	// sort the hosts by this metric first, like FreeMemoryPercent, instead of by name only
+	SortBy   string
+	SortDesc bool
+
+	// one row per host and CPUID level, for EVC planning
+	CpuFeatureOutpath string
+
+	// one row per cluster with the capacity left after the HA reserve
+	ClusterOutpath string
+
+	// one row per host bus adapter, for SAN connectivity audits
+	HbaOutpath string
+
+	// daemon mode writes a new file per cycle with the cycle's start time in its name
+	TimestampOutput bool
+
+	// log to a rotated file as well as, or instead of, stderr
+	LogFile       string
+	LogFileOnly   bool
+	LogMaxSizeMB  int
+	LogMaxBackups int
+	LogMaxAgeDays int
+
+	// vSphere tag categories and custom attributes collected as columns
+	TagCategories    []string
+	CustomAttributes []string
+
+	// serve the latest results over http in daemon mode
+	Listen         string
+	APIToken       string
+	ReadyIntervals int
+	// runs listed by GET /api/runs, kept across restarts in RunHistoryFile when set
+	RunHistory     int
+	RunHistoryFile string
+
+	// API politeness, per vcenter limits default to these
+	MaxConcurrentRequests int
+	RequestsPerSecond     float64
+	ConnectDelay          Duration
+	ConnectJitter         Duration
+	// another name for ConnectDelay, ConnectDelay wins when both are set
+	WorkerStartDelay Duration
+	// host retrieves run at once on a vcenter, each on a share of its hosts, per vcenter entries override it
+	MaxHostConcurrency int
+	// vcenters collected at once with the same username, the others wait for one of them to log out
+	MaxSessionsPerUser int
+
+	// fail the run when fewer hosts are collected than this
+	MinExpectedHosts int
+	// exit with a partial failure when some vcenters failed, on unless set to false
+	FailOnPartial *bool
+	// write a JSON summary of the run next to the output
+	WriteSummary bool
+	// list the failed vcenters in the JSON output and in an errors file next to csv outputs
+	ErrorReport bool
+	// replace output files that already exist instead of refusing to run
+	Overwrite bool
+	// bounds a whole run, collecting and writing, collection stops early to leave time for the outputs
+	RunTimeout Duration
+	// bounds each property collector retrieve in a collection, separate from the connect timeout
+	RetrieveTimeoutSeconds int
+	// bound connecting and logging in, the collection from one vcenter and logging out, 0 for the defaults
+	ConnectTimeoutSeconds int
+	CollectTimeoutSeconds int
+	LogoutTimeoutSeconds  int
+	// collect the vcenters that failed once more, one after the other, once the others are done
+	RetryFailedAtEnd bool
+	// drop the hosts of a vcenter that failed part way through instead of writing them next to its error
+	DiscardPartialResults bool
+	// replace the outputs with what was collected when the run was cut short or every vcenter failed
+	KeepPartialOutput bool
+	// write the hosts when a lookup like the clusters or datastores fails, with the reason in the Error column
+	IncludePartialRows bool
+
+	// keep cluster names across workers and daemon cycles instead of looking them up every collection
+	SharedNameCache bool
+	NameCacheTTL    Duration
+
+	// keep only the first host of every name when linked or overlapping vcenters return a host more than once
+	DeduplicateHosts bool
+
+	// write the MemorySizeBytes column, the host's memory in bytes without unit formatting
+	MemorySizeBytes bool
+	// write the EstimatedFreeVMs column, how many vms of this size fit in the free capacity of each host
+	AverageVM *VMSize
+
+	// keep a second instance from writing the same outputs, the lock defaults to the Outpath with .lock appended
+	Lock     bool
+	LockFile string
+
+	// only write the outputs when hosts were added, removed, upgraded or moved since the inventory in StateFile
+	StateFile string
+	Notify    *Notify
+
+	// threshold rules checked after collecting, breaking one exits with its own exit code
+	Alerts       []Alert
+	AlertOutpath string
+	AlertNotify  *Notify
+}
+
+// VCenter is a vcenter entry of the configuration or of the VCentersFile
+type VCenter struct {
+	Name                  string
+	Labels                map[string]string
+	Hostname              string
+	Username              string
+	Password              string
+	PasswordFile          string
+	PasswordSource        string
+	PasswordSecret        string
+	Datacenters           []string
+	Auth                  string
+	TokenFile             string
+	Token                 string
+	TokenEnv              string
+	Certificate           string
+	PrivateKey            string
+	Proxy                 string
+	MaxConcurrentRequests int
+	RequestsPerSecond     float64
+	MaxHostConcurrency    int
+}
+
+// Output is one of the ExtraOutputs. ExcludeColumns drops columns,
+// RedactColumns keeps them but blanks their values so the file's schema stays the same.
+type Output struct {
+	Path           string
+	Format         string
+	ExcludeColumns []string
+	RedactColumns  []string
+
+	// kafka outputs publish every host as a message to Topic instead of writing Path
+	Brokers []string
+	Topic   string
+	// passed as they are to the writer of Format, like {"Comma": ";"} for csv
+	Options RawOptions
+}
+
+// Alert is a threshold checked against every host, or against the totals of every cluster.
+// Rule is a metric, an operator and a number, like "FreeMemoryPercent < 10".
+// Clusters and VCenters are globs and Labels vcenter labels that must all match for the rule to apply.
+type Alert struct {
+	Name     string
+	Rule     string
+	Cluster  bool
+	Clusters []string
+	VCenters []string
+	Labels   map[string]string
+}
+
+// Mail is the SMTP server and message the results are mailed with
+type Mail struct {
+	Host    string
+	Port    int
+	From    string
+	To      string
+	Body    string
+	Subject string
+}
+
+// Notify is where notices are sent, like inventory changes found with StateFile
+type Notify struct {
+	// each gets a POST with the notice as JSON
+	Webhooks []string
+	// a Slack incoming webhook, it gets the notice as readable text
+	Slack string
+	// mail the readable text with the Mail settings
+	Mail bool
+}
+
+// VMSize is the average vm of AverageVM, a vCPU is counted as one core of the host it runs on
+type VMSize struct {
+	Vcpus    int
+	MemoryMB int64
+}
+
+// Validate checks that the size is set and not negative
+func (size *VMSize) Validate() error {
+	if size.Vcpus < 0 || size.MemoryMB < 0 {
+		return fmt.Errorf("Vcpus and MemoryMB can't be negative")
+	}
+	if size.Vcpus == 0 && size.MemoryMB == 0 {
+		return fmt.Errorf("set Vcpus, MemoryMB or both")
+	}
+	return nil
+}
+
+// Duration is a time.Duration read from config as a string like "200ms" or "15m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
+// UnmarshalText reads the duration from a TOML string
+func (d *Duration) UnmarshalText(b []byte) error {
+	parsed, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// RawOptions are writer options kept as JSON for the writer to decode, in a TOML configuration
+// they are a table that is turned into the same JSON
+type RawOptions json.RawMessage
+
+func (o RawOptions) MarshalJSON() ([]byte, error) {
+	return json.RawMessage(o).MarshalJSON()
+}
+
+func (o *RawOptions) UnmarshalJSON(b []byte) error {
+	return (*json.RawMessage)(o).UnmarshalJSON(b)
+}
+
+// UnmarshalTOML re-marshals the table toml decoded the options into as JSON
+func (o *RawOptions) UnmarshalTOML(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	*o = b
+	return nil
+}
+
+// Read opens and decodes the configuration file, as JSON or TOML by its extension.
+// Its errors name the absolute path it tried.
+func Read(path string) (Config, error) {
+	config := Config{}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".json" && ext != ".toml" {
+		return config, fmt.Errorf("%s: unknown configuration format %q, use .json or .toml", path, ext)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+
+	if ext == ".toml" {
+		_, err = toml.NewDecoder(file).Decode(&config)
+	} else {
+		err = json.NewDecoder(file).Decode(&config)
+	}
+	if err != nil {
+		return config, fmt.Errorf("could not decode %s: %v", path, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadErrors(t *testing.T) {
+	dir := t.TempDir()
+	malformed := filepath.Join(dir, "malformed.json")
+	if err := os.WriteFile(malformed, []byte(`{"Outpath": "hosts.csv",`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wrongType := filepath.Join(dir, "wrong-type.json")
+	if err := os.WriteFile(wrongType, []byte(`{"Outpath": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "missing.json"), malformed, wrongType, filepath.Join(dir, "config.yaml")} {
+		if _, err := Read(path); err == nil {
+			t.Errorf("reading %s did not fail", filepath.Base(path))
+		} else if !strings.Contains(err.Error(), path) {
+			t.Errorf("error reading %s does not name its path: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+// writer options are handed on as JSON, from a TOML configuration too
+func TestReadOptions(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `{"OutputOptions": {"Comma": ";"}, "ExtraOutputs": [{"Path": "tabs.csv", "Options": {"Comma": "\t"}}]}`,
+		"config.toml": "OutputOptions = { Comma = \";\" }\n\n[[ExtraOutputs]]\nPath = \"tabs.csv\"\nOptions = { Comma = \"\\t\" }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := Read(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(config.ExtraOutputs) != 1 {
+			t.Fatalf("%s: %d extra outputs", name, len(config.ExtraOutputs))
+		}
+		for options, want := range map[*RawOptions]string{&config.OutputOptions: ";", &config.ExtraOutputs[0].Options: "\t"} {
+			var decoded struct{ Comma string }
+			if err := json.Unmarshal(*options, &decoded); err != nil || decoded.Comma != want {
+				t.Errorf("%s: options %s, want Comma %q", name, *options, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadVCenters reads the vcenters of a VCentersFile, a JSON list of vcenter entries or a csv
+func ReadVCenters(path string) ([]*VCenter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var vcenters []*VCenter
+		if err := json.NewDecoder(file).Decode(&vcenters); err != nil {
+			return nil, err
+		}
+		return vcenters, nil
+	case ".csv":
+		return readVCentersCSV(file)
+	default:
+		return nil, fmt.Errorf("unknown file type %q, use .json or .csv", filepath.Ext(path))
+	}
+}
+
+// readVCentersCSV reads vcenters from a csv with a header row.
+// Known columns are Hostname, Username, Password, Name and Proxy, columns named "label.<key>" become labels.
+func readVCentersCSV(r io.Reader) ([]*VCenter, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	var vcenters []*VCenter
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		vcenter := &VCenter{}
+		for i, header := range headers {
+			value := record[i]
+			switch key := strings.ToLower(header); {
+			case key == "hostname":
+				vcenter.Hostname = value
+			case key == "username":
+				vcenter.Username = value
+			case key == "password":
+				vcenter.Password = value
+			case key == "name":
+				vcenter.Name = value
+			case key == "proxy":
+				vcenter.Proxy = value
+			case strings.HasPrefix(key, "label."):
+				if value == "" {
+					continue
+				}
+				if vcenter.Labels == nil {
+					vcenter.Labels = make(map[string]string)
+				}
+				vcenter.Labels[header[len("label."):]] = value
+			default:
+				return nil, fmt.Errorf("unknown column %q", header)
+			}
+		}
+		if vcenter.Hostname == "" {
+			return nil, fmt.Errorf("line %d has no hostname", len(vcenters)+2)
+		}
+		vcenters = append(vcenters, vcenter)
+	}
+
+	return vcenters, nil
+}
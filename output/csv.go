@@ -0,0 +1,69 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+func init() {
+	Register("csv", newCSVWriter)
+}
+
+// csvOptions are the Options of a csv output, Comma is the separator, "," unless set, like ";" for
+// spreadsheets in locales that write decimals with a comma
+type csvOptions struct {
+	Comma string
+}
+
+// csvWriter writes a header line and a line per record
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// CSVComma is the separator the csv options set, for reading back what the csv writer wrote
+func CSVComma(options json.RawMessage) (rune, error) {
+	var opts csvOptions
+	if len(bytes.TrimSpace(options)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(options))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&opts); err != nil {
+			return 0, fmt.Errorf("invalid csv options: %v", err)
+		}
+	}
+	if opts.Comma == "" {
+		return ',', nil
+	}
+	comma, size := utf8.DecodeRuneInString(opts.Comma)
+	if size != len(opts.Comma) || comma == '"' || comma == '\r' || comma == '\n' || comma == utf8.RuneError {
+		return 0, fmt.Errorf("invalid csv options: Comma must be a single character other than a quote or a line break, not %q", opts.Comma)
+	}
+	return comma, nil
+}
+
+func newCSVWriter(_ context.Context, w io.Writer, options json.RawMessage) (Writer, error) {
+	comma, err := CSVComma(options)
+	if err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+	return &csvWriter{w: writer}, nil
+}
+
+func (c *csvWriter) Start(headers []string) error {
+	return c.w.Write(headers)
+}
+
+func (c *csvWriter) WriteRecord(record Record) error {
+	return c.w.Write(record.Row)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,49 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCSVWriter(t *testing.T) {
+	tests := []struct {
+		options string
+		want    string
+	}{
+		{"", "Host,Cluster\nesx1,\"a,b\"\n"},
+		{`{}`, "Host,Cluster\nesx1,\"a,b\"\n"},
+		{`{"Comma": ";"}`, "Host;Cluster\nesx1;a,b\n"},
+		{`{"Comma": "\t"}`, "Host\tCluster\nesx1\ta,b\n"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		err := Write(context.Background(), &b, "csv", json.RawMessage(test.options), []string{"Host", "Cluster"}, []Record{{Row: []string{"esx1", "a,b"}}})
+		if err != nil {
+			t.Errorf("options %s: %v", test.options, err)
+			continue
+		}
+		if b.String() != test.want {
+			t.Errorf("options %s: written %q, want %q", test.options, b.String(), test.want)
+		}
+	}
+}
+
+func TestCSVOptionsInvalid(t *testing.T) {
+	for _, options := range []string{`{"Comma": ";;"}`, `{"Comma": "\""}`, `{"Comma": "\n"}`, `{"Separator": ";"}`, `[1]`} {
+		if _, err := newCSVWriter(context.Background(), &bytes.Buffer{}, json.RawMessage(options)); err == nil || !strings.Contains(err.Error(), "invalid csv options") {
+			t.Errorf("options %s: error %v, want them rejected", options, err)
+		}
+	}
+}
+
+func TestCSVComma(t *testing.T) {
+	for options, want := range map[string]rune{"": ',', `{"Comma": ";"}`: ';', `{"Comma": "|"}`: '|'} {
+		comma, err := CSVComma(json.RawMessage(options))
+		if err != nil || comma != want {
+			t.Errorf("options %q: comma %q and error %v, want %q", options, comma, err, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+func init() {
+	Register("json", newJSONWriter)
+}
+
+// jsonOptions are the Options of a json output, Pretty indents it with two spaces
+type jsonOptions struct {
+	Pretty bool
+}
+
+// jsonWriter writes the records as one array, the Value of each or an object of its columns without one
+type jsonWriter struct {
+	w       io.Writer
+	pretty  bool
+	headers []string
+	values  []interface{}
+}
+
+func newJSONWriter(_ context.Context, w io.Writer, options json.RawMessage) (Writer, error) {
+	var opts jsonOptions
+	if len(bytes.TrimSpace(options)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(options))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&opts); err != nil {
+			return nil, fmt.Errorf("invalid json options: %v", err)
+		}
+	}
+	return &jsonWriter{w: w, pretty: opts.Pretty, values: []interface{}{}}, nil
+}
+
+func (j *jsonWriter) Start(headers []string) error {
+	j.headers = headers
+	return nil
+}
+
+func (j *jsonWriter) WriteRecord(record Record) error {
+	if record.Value != nil {
+		j.values = append(j.values, record.Value)
+		return nil
+	}
+	value := make(map[string]string, len(j.headers))
+	for i, header := range j.headers {
+		if i < len(record.Row) {
+			value[header] = record.Row[i]
+		}
+	}
+	j.values = append(j.values, value)
+	return nil
+}
+
+// Close writes the array, the records are kept until then as it is only valid once complete
+func (j *jsonWriter) Close() error {
+	var out []byte
+	var err error
+	if j.pretty {
+		out, err = json.MarshalIndent(j.values, "", "  ")
+	} else {
+		out, err = json.Marshal(j.values)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(append(out, '\n'))
+	return err
+}
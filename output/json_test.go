@@ -0,0 +1,57 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONWriter(t *testing.T) {
+	type host struct {
+		Host  string
+		Cores int
+	}
+	records := []Record{
+		{Row: []string{"esx1", "8"}, Value: host{"esx1", 8}},
+		// a record without a Value is written as its columns
+		{Row: []string{"esx2", "16"}},
+	}
+	tests := []struct {
+		options string
+		want    string
+	}{
+		{"", `[{"Host":"esx1","Cores":8},{"Cores":"16","Host":"esx2"}]` + "\n"},
+		{`{"Pretty": true}`, "[\n  {\n    \"Host\": \"esx1\",\n    \"Cores\": 8\n  },\n  {\n    \"Cores\": \"16\",\n    \"Host\": \"esx2\"\n  }\n]\n"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := Write(context.Background(), &b, "json", json.RawMessage(test.options), []string{"Host", "Cores"}, records); err != nil {
+			t.Errorf("options %s: %v", test.options, err)
+			continue
+		}
+		if b.String() != test.want {
+			t.Errorf("options %s: written %q, want %q", test.options, b.String(), test.want)
+		}
+	}
+}
+
+// an output without records is an empty array, not null
+func TestJSONWriterEmpty(t *testing.T) {
+	var b bytes.Buffer
+	if err := Write(context.Background(), &b, "json", nil, []string{"Host"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "[]\n" {
+		t.Errorf("written %q, want []", b.String())
+	}
+}
+
+func TestJSONOptionsInvalid(t *testing.T) {
+	for _, options := range []string{`{"Pretty": "yes"}`, `{"Indent": 2}`} {
+		if _, err := newJSONWriter(context.Background(), &bytes.Buffer{}, json.RawMessage(options)); err == nil || !strings.Contains(err.Error(), "invalid json options") {
+			t.Errorf("options %s: error %v, want them rejected", options, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func init() {
+	Register("kafka", newKafkaWriter)
+}
+
+// kafkaTimeout bounds publishing all records of an output, including the final flush
+const kafkaTimeout = time.Minute
+
+// kafkaOptions are the Options of a kafka output, the brokers to connect to and the topic to publish to
+type kafkaOptions struct {
+	Brokers []string
+	Topic   string
+}
+
+// kafkaWriter publishes every record as a JSON message keyed by its Key instead of writing to w. The
+// messages are sent together on Close, which returns once the brokers acknowledged or failed them.
+type kafkaWriter struct {
+	ctx      context.Context
+	options  kafkaOptions
+	headers  []string
+	messages []kafka.Message
+}
+
+func newKafkaWriter(ctx context.Context, _ io.Writer, options json.RawMessage) (Writer, error) {
+	var opts kafkaOptions
+	if len(bytes.TrimSpace(options)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(options))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&opts); err != nil {
+			return nil, fmt.Errorf("invalid kafka options: %v", err)
+		}
+	}
+	if len(opts.Brokers) == 0 || opts.Topic == "" {
+		return nil, fmt.Errorf("kafka output needs Brokers and a Topic")
+	}
+	return &kafkaWriter{ctx: ctx, options: opts}, nil
+}
+
+func (k *kafkaWriter) Start(headers []string) error {
+	k.headers = headers
+	return nil
+}
+
+func (k *kafkaWriter) WriteRecord(record Record) error {
+	value := record.Value
+	if value == nil {
+		columns := make(map[string]string, len(k.headers))
+		for i, header := range k.headers {
+			if i < len(record.Row) {
+				columns[header] = record.Row[i]
+			}
+		}
+		value = columns
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	k.messages = append(k.messages, kafka.Message{Key: []byte(record.Key), Value: b})
+	return nil
+}
+
+func (k *kafkaWriter) Close() error {
+	if len(k.messages) == 0 {
+		return nil
+	}
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(k.options.Brokers...),
+		Topic:        k.options.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+	ctx, cancel := context.WithTimeout(k.ctx, kafkaTimeout)
+	defer cancel()
+
+	err := w.WriteMessages(ctx, k.messages...)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if errs, ok := err.(kafka.WriteErrors); ok {
+		for _, e := range errs {
+			if e != nil {
+				return fmt.Errorf("%d of %d messages failed: %v", errs.Count(), len(k.messages), e)
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,28 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func TestKafkaOptions(t *testing.T) {
+	valid := `{"Brokers": ["kafka1:9092"], "Topic": "esxi-hosts"}`
+	if _, err := newKafkaWriter(context.Background(), io.Discard, json.RawMessage(valid)); err != nil {
+		t.Errorf("options %s: %v", valid, err)
+	}
+	for _, options := range []string{"", `{"Topic": "esxi-hosts"}`, `{"Brokers": ["kafka1:9092"]}`, `{"Brokers": "kafka1:9092", "Topic": "esxi-hosts"}`, `{"Brokers": ["kafka1:9092"], "Topic": "esxi-hosts", "Acks": 1}`} {
+		if _, err := newKafkaWriter(context.Background(), io.Discard, json.RawMessage(options)); err == nil {
+			t.Errorf("options %s accepted", options)
+		}
+	}
+}
+
+// nothing is sent without records, so no broker is needed
+func TestKafkaWriterEmpty(t *testing.T) {
+	options := json.RawMessage(`{"Brokers": ["127.0.0.1:1"], "Topic": "esxi-hosts"}`)
+	if err := Write(context.Background(), io.Discard, "kafka", options, []string{"Host"}, nil); err != nil {
+		t.Error(err)
+	}
+}
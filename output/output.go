@@ -0,0 +1,96 @@
+// Package output holds the writers hostStats writes its outputs with, selected by the Format of an
+// output. Programs using the collector can register writers of their own.
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Writer writes one output. Start is called once with the columns, WriteRecord for every record in
+// order and Close at the end, after which everything has to be written to the io.Writer it was made for.
+type Writer interface {
+	Start(headers []string) error
+	WriteRecord(record Record) error
+	Close() error
+}
+
+// Record is one row of an output, like a host. Row has its values as text in the order of the headers,
+// Value is the record itself, a struct or a map of the columns, for writers that keep the types. Key
+// identifies the record to writers that need one, like the host name as the key of a kafka message.
+type Record struct {
+	Row   []string
+	Value interface{}
+	Key   string
+}
+
+// Factory makes a writer to w. Options is the raw Options of the output in the configuration, empty
+// when it has none, a writer that takes no options may ignore it. ctx bounds a writer that sends its
+// records over the network instead of to w, like kafka, until it is closed.
+type Factory func(ctx context.Context, w io.Writer, options json.RawMessage) (Writer, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register makes a writer available as format. It panics when format is already registered, like
+// database/sql drivers, as two writers of the same name are a programming error.
+func Register(format string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if factory == nil {
+		panic("output: Register of a nil factory for " + format)
+	}
+	if _, ok := factories[format]; ok {
+		panic("output: Register called twice for " + format)
+	}
+	factories[format] = factory
+}
+
+// Lookup returns the writer registered as format
+func Lookup(format string) (Factory, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	factory, ok := factories[format]
+	return factory, ok
+}
+
+// Formats lists the registered formats, sorted
+func Formats() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	formats := make([]string, 0, len(factories))
+	for format := range factories {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Write writes records to w with the writer registered as format
+func Write(ctx context.Context, w io.Writer, format string, options json.RawMessage, headers []string, records []Record) error {
+	factory, ok := Lookup(format)
+	if !ok {
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	writer, err := factory(ctx, w, options)
+	if err != nil {
+		return err
+	}
+	if err := writer.Start(headers); err != nil {
+		writer.Close()
+		return err
+	}
+	for _, record := range records {
+		if err := writer.WriteRecord(record); err != nil {
+			writer.Close()
+			return err
+		}
+	}
+	return writer.Close()
+}
@@ -0,0 +1,61 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// upperWriter writes the first column of every record in upper case, a writer registered from outside
+type upperWriter struct {
+	w io.Writer
+}
+
+func (u upperWriter) Start(headers []string) error { return nil }
+
+func (u upperWriter) WriteRecord(record Record) error {
+	_, err := io.WriteString(u.w, strings.ToUpper(record.Row[0])+"\n")
+	return err
+}
+
+func (u upperWriter) Close() error { return nil }
+
+func TestRegister(t *testing.T) {
+	Register("test-upper", func(_ context.Context, w io.Writer, _ json.RawMessage) (Writer, error) {
+		return upperWriter{w: w}, nil
+	})
+	for _, format := range []string{"csv", "json", "kafka", "test-upper"} {
+		if _, ok := Lookup(format); !ok {
+			t.Errorf("%s is not registered", format)
+		}
+	}
+	if formats := Formats(); !slices.IsSorted(formats) || !slices.Contains(formats, "test-upper") {
+		t.Errorf("formats %v, want them sorted with test-upper", formats)
+	}
+
+	var b bytes.Buffer
+	if err := Write(context.Background(), &b, "test-upper", nil, []string{"Host"}, []Record{{Row: []string{"esx1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "ESX1\n" {
+		t.Errorf("written %q, want ESX1", b.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering csv again did not panic")
+		}
+	}()
+	Register("csv", newCSVWriter)
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	err := Write(context.Background(), io.Discard, "xml", nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), `"xml"`) {
+		t.Errorf("error %v, want it to name the unknown format", err)
+	}
+}